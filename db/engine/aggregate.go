@@ -0,0 +1,462 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// accumulator folds the argument values of an aggregate call over the rows of a group
+type accumulator interface {
+	add(v interface{}) error
+	result() interface{}
+}
+
+// aggregates holds the aggregate functions, by upper-cased name
+var aggregates = map[string]func(Dialect) accumulator{
+	"COUNT": func(Dialect) accumulator { return &countAcc{} },
+	"SUM":   func(Dialect) accumulator { return &sumAcc{} },
+	"AVG":   func(Dialect) accumulator { return &avgAcc{} },
+	"MIN":   func(d Dialect) accumulator { return &extremeAcc{d: d, sign: -1} },
+	"MAX":   func(d Dialect) accumulator { return &extremeAcc{d: d, sign: 1} },
+}
+
+func isAggregate(expr parser.Expr) bool {
+	call, ok := expr.(*parser.FuncCall)
+	if !ok {
+		return false
+	}
+	_, ok = aggregates[call.Name]
+	return ok
+}
+
+// countAcc counts the non-NULL values, COUNT(*) counts every row
+type countAcc struct {
+	n int64
+}
+
+func (c *countAcc) add(v interface{}) error {
+	if v != nil {
+		c.n++
+	}
+	return nil
+}
+
+func (c *countAcc) result() interface{} {
+	return c.n
+}
+
+// sumAcc adds up numbers, exactly while they are all integers and their
+// sum fits in an int64
+type sumAcc struct {
+	seen    bool
+	isFloat bool
+	i       int64
+	f       float64
+}
+
+func (s *sumAcc) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	s.seen = true
+	if !s.isFloat {
+		if n, ok := toInt(v); ok {
+			if sum, ok := addInts(s.i, n); ok {
+				s.i = sum
+				return nil
+			}
+		}
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return &TypeMismatchError{Context: "SUM", Want: "a number", Value: v}
+	}
+	if !s.isFloat {
+		s.isFloat = true
+		s.f = float64(s.i)
+	}
+	s.f += f
+	return nil
+}
+
+func (s *sumAcc) result() interface{} {
+	switch {
+	case !s.seen:
+		return nil
+	case s.isFloat:
+		return s.f
+	}
+	return s.i
+}
+
+// avgAcc averages numbers
+type avgAcc struct {
+	n   int64
+	sum float64
+}
+
+func (a *avgAcc) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return &TypeMismatchError{Context: "AVG", Want: "a number", Value: v}
+	}
+	a.n++
+	a.sum += f
+	return nil
+}
+
+func (a *avgAcc) result() interface{} {
+	if a.n == 0 {
+		return nil
+	}
+	return a.sum / float64(a.n)
+}
+
+// extremeAcc keeps the smallest (sign -1) or largest (sign 1) value, in the
+// order used by ORDER BY. Which sort kind that is depends on every value of
+// the group, so the extreme of each kind is kept until the group ends.
+type extremeAcc struct {
+	d       Dialect
+	sign    int
+	n       int
+	numbers int // values holding numbers
+	times   int // date and timestamp values
+	v       [3]interface{}
+}
+
+func (x *extremeAcc) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	x.n++
+	x.keep(textSort, v)
+	if holdsNumber(v) {
+		x.numbers++
+		x.keep(numberSort, v)
+	}
+	if isTime(v) {
+		x.times++
+		x.keep(timeSort, v)
+	}
+	return nil
+}
+
+func (x *extremeAcc) keep(kind sortKind, v interface{}) {
+	if x.v[kind] == nil || x.d.sortOrder(v, x.v[kind], kind) == x.sign {
+		x.v[kind] = v
+	}
+}
+
+func (x *extremeAcc) result() interface{} {
+	switch x.n {
+	case x.numbers:
+		return x.v[numberSort]
+	case x.times:
+		return x.v[timeSort]
+	}
+	return x.v[textSort]
+}
+
+// distinctAcc passes each distinct value to acc once, for COUNT(DISTINCT x)
+type distinctAcc struct {
+	d    Dialect
+	acc  accumulator
+	seen map[string]bool
+}
+
+func (d *distinctAcc) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	key := d.d.valueKey(v)
+	if d.seen[key] {
+		return nil
+	}
+	d.seen[key] = true
+	return d.acc.add(v)
+}
+
+func (d *distinctAcc) result() interface{} {
+	return d.acc.result()
+}
+
+// valueKey encodes values so that equal values, and only those, have equal
+// keys. Values are compared by their text, as collated by the dialect, so the
+// hash value "1" and the number 1 are equal, but NULL differs from the string
+// "NULL".
+func (d Dialect) valueKey(values ...interface{}) string {
+	var sb strings.Builder
+	for _, v := range values {
+		if v == nil {
+			sb.WriteString("n")
+		} else {
+			sb.WriteString("v")
+			sb.WriteString(d.collate(toString(v)))
+		}
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+// prepareGrouping resolves the GROUP BY clause, collects the aggregate calls
+// and checks that the SELECT list only uses grouped columns outside of them
+func (q *query) prepareGrouping() error {
+	for _, expr := range q.stmt.GroupBy {
+		q.groupBy = append(q.groupBy, q.groupExpr(expr))
+	}
+
+	for _, j := range q.stmt.Joins {
+		if err := noAggregate("ON", j.On); err != nil {
+			return err
+		}
+	}
+	if err := noAggregate("WHERE", q.stmt.Where); err != nil {
+		return err
+	}
+	for _, expr := range q.groupBy {
+		if err := noAggregate("GROUP BY", expr); err != nil {
+			return err
+		}
+	}
+
+	exprs := []parser.Expr{}
+	for _, f := range q.stmt.Fields {
+		exprs = append(exprs, f.Expr)
+	}
+	for _, item := range q.stmt.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	exprs = append(exprs, q.having)
+	seen := make(map[string]bool)
+	var err error
+	for _, expr := range exprs {
+		parser.Walk(expr, func(e parser.Expr) bool {
+			if !isAggregate(e) {
+				return true
+			}
+			call := e.(*parser.FuncCall)
+			if len(call.Args) != 1 {
+				err = fmt.Errorf("%s expects 1 argument, got %d", call.Name, len(call.Args))
+			} else if _, star := call.Args[0].(*parser.StarExpr); star && call.Name != "COUNT" {
+				err = fmt.Errorf("%s(*) is not supported", call.Name)
+			} else if inner := findAggregate(call.Args[0]); inner != nil {
+				err = &AggregateUseError{Func: inner.Name, Outer: call.Name}
+			}
+			if !seen[call.String()] {
+				seen[call.String()] = true
+				q.aggregates = append(q.aggregates, call)
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !q.grouped() {
+		return nil
+	}
+	for _, f := range q.stmt.Fields {
+		if err := q.checkGrouped(f.Expr); err != nil {
+			return err
+		}
+	}
+	return q.checkGrouped(q.having)
+}
+
+// noAggregate rejects aggregate calls in a clause evaluated on single rows
+func noAggregate(clause string, expr parser.Expr) error {
+	if call := findAggregate(expr); call != nil {
+		return &AggregateUseError{Func: call.Name, Clause: clause}
+	}
+	return nil
+}
+
+// findAggregate returns the first aggregate call in expr, if any
+func findAggregate(expr parser.Expr) *parser.FuncCall {
+	var found *parser.FuncCall
+	parser.Walk(expr, func(e parser.Expr) bool {
+		if found == nil && isAggregate(e) {
+			found = e.(*parser.FuncCall)
+		}
+		return found == nil
+	})
+	return found
+}
+
+// groupExpr resolves a GROUP BY entry naming a SELECT list alias, or a
+// position such as GROUP BY 1, to the expression it stands for
+func (q *query) groupExpr(expr parser.Expr) parser.Expr {
+	switch e := expr.(type) {
+	case *parser.ColumnRef:
+		if e.Table == "" {
+			for _, f := range q.stmt.Fields {
+				if f.Alias != "" && strings.EqualFold(f.Alias, e.Name) {
+					return f.Expr
+				}
+			}
+		}
+	case *parser.Literal:
+		if n, ok := e.Value.(int64); ok && n >= 1 && int(n) <= len(q.stmt.Fields) {
+			return q.stmt.Fields[n-1].Expr
+		}
+	}
+	return expr
+}
+
+// havingExpr resolves the SELECT list aliases used in HAVING, as in
+// HAVING users > 100 for COUNT(*) AS users
+func (q *query) havingExpr(expr parser.Expr) parser.Expr {
+	return parser.Rewrite(expr, func(e parser.Expr) parser.Expr {
+		col, ok := e.(*parser.ColumnRef)
+		if !ok || col.Table != "" {
+			return nil
+		}
+		for _, f := range q.stmt.Fields {
+			if f.Alias != "" && strings.EqualFold(f.Alias, col.Name) {
+				return f.Expr
+			}
+		}
+		return nil
+	})
+}
+
+// grouped reports whether the query aggregates its rows, which a HAVING
+// clause implies even without GROUP BY or aggregate functions
+func (q *query) grouped() bool {
+	return len(q.groupBy) > 0 || len(q.aggregates) > 0 || q.having != nil
+}
+
+// checkGrouped rejects columns used outside of aggregates that aren't grouped on,
+// in the SELECT list and HAVING
+func (q *query) checkGrouped(expr parser.Expr) error {
+	var err error
+	parser.Walk(expr, func(e parser.Expr) bool {
+		if err != nil || isAggregate(e) || q.isGroupKey(e) {
+			return false
+		}
+		switch e.(type) {
+		case *parser.ColumnRef, *parser.StarExpr:
+			err = &GroupByError{Expr: e}
+		}
+		return true
+	})
+	return err
+}
+
+func (q *query) isGroupKey(expr parser.Expr) bool {
+	for _, g := range q.groupBy {
+		if g.String() == expr.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateOp groups its input with a hash table holding, for each group,
+// one of its rows and the running state of every aggregate. Rows are folded
+// into their group as they stream past, so only the groups stay in memory.
+// Without GROUP BY there is a single group, even over no rows at all.
+type aggregateOp struct {
+	q      *query
+	child  operator
+	groups []*group
+	done   bool
+}
+
+// group is the state of one GROUP BY key
+type group struct {
+	rec  *record
+	accs []accumulator
+}
+
+func (a *aggregateOp) next(ctx context.Context) (*record, error) {
+	if !a.done {
+		if err := a.aggregate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(a.groups) == 0 {
+		return nil, nil
+	}
+	g := a.groups[0]
+	a.groups = a.groups[1:]
+
+	row := make(Row, len(g.rec.row)+len(g.accs))
+	for name, v := range g.rec.row {
+		row[name] = v
+	}
+	for i, call := range a.q.aggregates {
+		row[call.String()] = g.accs[i].result()
+	}
+	rec := *g.rec
+	rec.row = row
+	return &rec, nil
+}
+
+func (a *aggregateOp) aggregate(ctx context.Context) error {
+	a.done = true
+	index := make(map[string]*group)
+	for {
+		rec, err := a.child.next(ctx)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			break
+		}
+		a.q.row(rec) // kept with the group for the columns used outside of aggregates
+
+		values := make([]interface{}, len(a.q.groupBy))
+		for i, expr := range a.q.groupBy {
+			if values[i], err = a.q.eval(ctx, expr, rec); err != nil {
+				return err
+			}
+		}
+		key := a.q.e.Dialect.valueKey(values...)
+		g, ok := index[key]
+		if !ok {
+			g = a.newGroup(rec)
+			index[key] = g
+			a.groups = append(a.groups, g)
+		}
+
+		for i, call := range a.q.aggregates {
+			var v interface{} = true
+			if _, star := call.Args[0].(*parser.StarExpr); !star {
+				if v, err = a.q.eval(ctx, call.Args[0], rec); err != nil {
+					return err
+				}
+			}
+			if err := g.accs[i].add(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(a.groups) == 0 && len(a.q.groupBy) == 0 {
+		rec := a.q.newRecord()
+		rec.row = Row{}
+		a.groups = append(a.groups, a.newGroup(rec))
+	}
+	return nil
+}
+
+func (a *aggregateOp) newGroup(rec *record) *group {
+	g := &group{rec: rec}
+	for _, call := range a.q.aggregates {
+		d := a.q.e.Dialect
+		acc := aggregates[call.Name](d)
+		if call.Distinct {
+			acc = &distinctAcc{d: d, acc: acc, seen: make(map[string]bool)}
+		}
+		g.accs = append(g.accs, acc)
+	}
+	return g
+}
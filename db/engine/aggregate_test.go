@@ -0,0 +1,40 @@
+package engine
+
+import "testing"
+
+func TestGroupBy(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	for id, code := range map[string]string{"1": "2", "2": "10", "3": "1a", "4": "b"} {
+		mr.HSet("user:"+id, "code", code)
+	}
+	checkQueries(t, eng, []queryTest{
+		{"SELECT country, COUNT(*) FROM users GROUP BY country ORDER BY country", []string{"India | 2", "UK | 1", "USA | 2"}},
+		// COUNT(col) skips NULLs, as do the other aggregates
+		{"SELECT country, COUNT(age), SUM(age), MIN(age), MAX(age) FROM users GROUP BY country ORDER BY country", []string{
+			"India | 2 | 71 | 30 | 41",
+			"UK | 1 | 35 | 35 | 35",
+			"USA | 1 | 25 | 25 | 25",
+		}},
+		{"SELECT AVG(age) FROM users WHERE country = 'India'", []string{"35.5"}},
+		{"SELECT COUNT(*), COUNT(DISTINCT country), MIN(name), MAX(name) FROM users", []string{"5 | 3 | Ann | Eve"}},
+		// MIN and MAX compare as ORDER BY does: as text once any value isn't a number
+		{"SELECT MIN(code), MAX(code) FROM users WHERE id IN ('1', '2')", []string{"2 | 10"}},
+		{"SELECT MIN(code), MAX(code) FROM users", []string{"10 | b"}},
+		{"SELECT COUNT(*), SUM(age), AVG(age) FROM users WHERE country = 'none'", []string{"0 | NULL | NULL"}},
+		{"SELECT country AS c, COUNT(*) AS n FROM users GROUP BY c ORDER BY n DESC, c", []string{"India | 2", "USA | 2", "UK | 1"}},
+		{"SELECT country, COUNT(*) FROM users GROUP BY 1 ORDER BY 1 LIMIT 1", []string{"India | 2"}},
+		{"SELECT age > 30, COUNT(*) FROM users WHERE age IS NOT NULL GROUP BY age > 30 ORDER BY 1", []string{"false | 2", "true | 2"}},
+	})
+}
+
+func TestHaving(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT country FROM users GROUP BY country HAVING COUNT(*) > 1 ORDER BY country", []string{"India", "USA"}},
+		{"SELECT country, COUNT(*) AS n FROM users GROUP BY country HAVING n = 1", []string{"UK | 1"}},
+		{"SELECT country FROM users GROUP BY country HAVING MAX(age) > 30 AND country <> 'UK'", []string{"India"}},
+		// AVG skips Eve, who has no age
+		{"SELECT country FROM users GROUP BY country HAVING AVG(age) < 30", []string{"USA"}},
+		{"SELECT COUNT(*) FROM users HAVING COUNT(*) > 10", nil},
+	})
+}
@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-parse/parser"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Analysis is what EXPLAIN ANALYZE measured for an operator of a query, or
+// for a subquery, CTE or set operation it ran. Time includes the operators
+// below; commands, round trips and bytes are those the operator issued itself.
+type Analysis struct {
+	Operator   string
+	Loops      int64         // times the operator ran: once per step of a recursive CTE, once per run of a subquery
+	Rows       int64         // rows returned, over every loop
+	Time       time.Duration // spent in the operator and those below it
+	Commands   int64         // KeyDB commands
+	RoundTrips int64         // single commands and pipelines sent to KeyDB
+	Bytes      int64         // sent to and received from KeyDB, as encoded by the protocol
+	Children   []*Analysis
+
+	// key tells apart the queries run below the same operator, whose plans
+	// may start with the same operator
+	key string
+	// leaf is set on a correlated subquery, run with different values for
+	// each row: the commands of its runs count towards it, undivided
+	leaf    bool
+	running bool // a loop of the step has started and not ended
+}
+
+// Total returns the commands, round trips and bytes of a and of the
+// operators below it
+func (a *Analysis) Total() (commands, roundTrips, bytes int64) {
+	commands, roundTrips, bytes = a.Commands, a.RoundTrips, a.Bytes
+	for _, child := range a.Children {
+		c, r, b := child.Total()
+		commands += c
+		roundTrips += r
+		bytes += b
+	}
+	return commands, roundTrips, bytes
+}
+
+// child returns the operator below a named op, adding it the first time:
+// a query run again, by a recursive CTE, adds to the figures of its first run
+func (a *Analysis) child(op, key string) *Analysis {
+	for _, child := range a.Children {
+		if child.Operator == op && child.key == key {
+			return child
+		}
+	}
+	child := &Analysis{Operator: op, key: key}
+	a.Children = append(a.Children, child)
+	return child
+}
+
+// analysisKey is the context key of the operator being analyzed
+type analysisKey struct{}
+
+// analyzing returns the operator the KeyDB commands issued with ctx count
+// towards, nil unless EXPLAIN ANALYZE is running
+func analyzing(ctx context.Context) *Analysis {
+	a, _ := ctx.Value(analysisKey{}).(*Analysis)
+	return a
+}
+
+// analyzeEnter returns ctx with a step named op below the operator being
+// analyzed, a subquery, CTE or set operation, as the one being analyzed.
+// Below a correlated subquery, ctx is returned unchanged.
+func analyzeEnter(ctx context.Context, op string, leaf bool) context.Context {
+	parent := analyzing(ctx)
+	if parent == nil || parent.leaf {
+		return ctx
+	}
+	node := parent.child(op, "")
+	node.leaf = leaf
+	return context.WithValue(ctx, analysisKey{}, node)
+}
+
+// analyzeRun starts a loop of the step being analyzed, and returns the
+// function recording the rows it returned once it ends
+func analyzeRun(ctx context.Context) func(rows int) {
+	node := analyzing(ctx)
+	if node == nil || node.running {
+		return func(int) {}
+	}
+	node.running = true
+	node.Loops++
+	start := time.Now()
+	return func(rows int) {
+		node.running = false
+		node.Rows += int64(rows)
+		node.Time += time.Since(start)
+	}
+}
+
+// analyzeStep enters a step named op and starts a loop of it
+func analyzeStep(ctx context.Context, op string) (context.Context, func(rows int)) {
+	ctx = analyzeEnter(ctx, op, false)
+	return ctx, analyzeRun(ctx)
+}
+
+// analyzeSubquery enters the step of a subquery, sub as written in the
+// enclosing query and sel as run
+func analyzeSubquery(ctx context.Context, sub, sel *parser.SelectStmt) context.Context {
+	if analyzing(ctx) == nil {
+		return ctx
+	}
+	if sel != sub {
+		return analyzeEnter(ctx, "Correlated subquery: "+sub.String(), true)
+	}
+	return analyzeEnter(ctx, "Subquery: "+sub.String(), false)
+}
+
+// instrument wraps op and the operators below it so that they record what
+// they do below parent. The root of the plan is told apart by key, the text
+// of the statement.
+func (q *query) instrument(parent *Analysis, op operator, key string) operator {
+	node := parent.child(q.describe(op), key)
+	node.Loops++
+	if in := input(op); in != nil {
+		*in = q.instrument(node, *in, "")
+	}
+	return &analyzeOp{child: op, stats: node}
+}
+
+// analyzeOp measures the records an operator returns and the time it takes
+type analyzeOp struct {
+	child operator
+	stats *Analysis
+
+	// the context passed to child, derived from the last one received
+	parent context.Context
+	ctx    context.Context
+}
+
+func (a *analyzeOp) next(ctx context.Context) (*record, error) {
+	if ctx != a.parent {
+		a.parent, a.ctx = ctx, context.WithValue(ctx, analysisKey{}, a.stats)
+	}
+	start := time.Now()
+	rec, err := a.child.next(a.ctx)
+	a.stats.Time += time.Since(start)
+	if rec != nil {
+		a.stats.Rows++
+	}
+	return rec, err
+}
+
+// analyze runs EXPLAIN ANALYZE: it runs the query, drops its rows and
+// returns one row per operator with what it did, indented under the
+// operator reading its rows, and a last row with the totals of the query.
+// The same figures are in the Analysis of the result.
+func (e *Engine) analyze(ctx context.Context, s *parser.ExplainStmt, sc *scope) (*Result, error) {
+	root := &Analysis{Operator: s.Stmt.String(), Loops: 1}
+	start := time.Now()
+	res, err := e.exec(context.WithValue(ctx, analysisKey{}, root), s.Stmt, sc)
+	if err != nil {
+		return nil, err
+	}
+	root.Time = time.Since(start)
+	root.Rows = int64(len(res.Rows))
+
+	result := &Result{
+		Columns:  []string{"plan", "rows", "loops", "time (ms)", "commands", "round trips", "bytes"},
+		Analysis: root,
+	}
+	for _, child := range root.Children {
+		renderAnalysis(result, child, 0)
+	}
+	cmds, trips, bytes := root.Total()
+	result.Rows = append(result.Rows, []interface{}{"total", root.Rows, nil, millis(root.Time), cmds, trips, bytes})
+	return result, nil
+}
+
+func renderAnalysis(res *Result, a *Analysis, depth int) {
+	res.Rows = append(res.Rows, []interface{}{strings.Repeat("    ", depth) + "-> " + a.Operator, a.Rows, a.Loops, millis(a.Time), a.Commands, a.RoundTrips, a.Bytes})
+	for _, child := range a.Children {
+		renderAnalysis(res, child, depth+1)
+	}
+}
+
+// millis returns d in milliseconds, to the microsecond
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d.Microseconds())) / 1000
+}
+
+// analyzeHook counts the KeyDB commands issued for the operator being
+// analyzed, if any
+type analyzeHook struct{}
+
+func (analyzeHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (analyzeHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if a := analyzing(ctx); a != nil {
+		a.Commands++
+		a.RoundTrips++
+		a.Bytes += cmdSize(cmd)
+	}
+	return nil
+}
+
+func (analyzeHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (analyzeHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if a := analyzing(ctx); a != nil {
+		a.Commands += int64(len(cmds))
+		a.RoundTrips++
+		for _, cmd := range cmds {
+			a.Bytes += cmdSize(cmd)
+		}
+	}
+	return nil
+}
+
+// cmdSize returns the bytes of a command and of its reply in the Redis
+// protocol, for the replies of the commands the engine issues
+func cmdSize(cmd redis.Cmder) int64 {
+	n := arraySize(len(cmd.Args()))
+	for _, arg := range cmd.Args() {
+		n += bulkSize(fmt.Sprint(arg))
+	}
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		return n + int64(len(err.Error())) + 3
+	}
+
+	switch c := cmd.(type) {
+	case *redis.StringStringMapCmd:
+		n += arraySize(2 * len(c.Val()))
+		for field, value := range c.Val() {
+			n += bulkSize(field) + bulkSize(value)
+		}
+	case *redis.StringSliceCmd:
+		n += arraySize(len(c.Val()))
+		for _, s := range c.Val() {
+			n += bulkSize(s)
+		}
+	case *redis.ScanCmd:
+		keys, cursor := c.Val()
+		n += arraySize(2) + bulkSize(strconv.FormatUint(cursor, 10)) + arraySize(len(keys))
+		for _, key := range keys {
+			n += bulkSize(key)
+		}
+	case *redis.IntCmd:
+		n += int64(len(strconv.FormatInt(c.Val(), 10))) + 3
+	case *redis.BoolCmd:
+		n += 4
+	case *redis.StatusCmd:
+		n += int64(len(c.Val())) + 3
+	case *redis.StringCmd:
+		if c.Err() == redis.Nil {
+			n += 5
+		} else {
+			n += bulkSize(c.Val())
+		}
+	}
+	return n
+}
+
+// arraySize returns the bytes of the header of an array of n elements
+func arraySize(n int) int64 {
+	return int64(len(strconv.Itoa(n))) + 3
+}
+
+// bulkSize returns the bytes of the bulk string s
+func bulkSize(s string) int64 {
+	return int64(len(strconv.Itoa(len(s)))+len(s)) + 5
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// analyzeRows runs EXPLAIN ANALYZE query and returns its rows without
+// their time and bytes, which vary: plan | rows | loops | commands | round
+// trips. It checks that the bytes of operators issuing commands aren't 0.
+func analyzeRows(t *testing.T, eng *Engine, query string) []string {
+	t.Helper()
+	res, err := eng.Query(context.Background(), "EXPLAIN ANALYZE "+query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	rows := make([]string, len(res.Rows))
+	for i, row := range res.Rows {
+		if row[4].(int64) > 0 && row[6].(int64) == 0 {
+			t.Errorf("%s: %v issued commands of 0 bytes", query, row[0])
+		}
+		rows[i] = fmt.Sprintf("%v | %v | %s | %v | %v", row[0], row[1], formatValue(row[2]), row[4], row[5])
+	}
+	return rows
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	tests := []queryTest{
+		{"SELECT name FROM users WHERE id = '2'", []string{
+			"-> Project: name | 1 | 1 | 0 | 0",
+			"    -> Filter: (id = '2') | 1 | 1 | 0 | 0",
+			"        -> Key lookup users: HGETALL user:2 | 1 | 1 | 1 | 1",
+			"total | 1 | NULL | 1 | 1",
+		}},
+		{"SELECT u.name, p.city FROM users u JOIN profiles p ON p.id = u.id WHERE u.country = 'USA'", []string{
+			"-> Project: u.name, p.city | 1 | 1 | 0 | 0",
+			"    -> Filter: (u.country = 'USA') | 1 | 1 | 0 | 0",
+			"        -> Lookup join profiles AS p: p.id = u.id, HGETALL per row | 3 | 1 | 5 | 1",
+			"            -> Scan users AS u: SCAN MATCH user:*, HGETALL per key | 5 | 1 | 6 | 2",
+			"total | 1 | NULL | 11 | 3",
+		}},
+		{"SELECT name FROM users LIMIT 2", []string{
+			"-> Project: name | 2 | 1 | 0 | 0",
+			"    -> Limit: 2 | 2 | 1 | 0 | 0",
+			"        -> Scan users: SCAN MATCH user:*, HGETALL per key | 2 | 1 | 3 | 2",
+			"total | 2 | NULL | 3 | 2",
+		}},
+		// a correlated subquery runs once per row
+		{"SELECT name, (SELECT city FROM profiles p WHERE p.id = u.id) FROM users u", []string{
+			"-> Project: name, (SELECT city FROM profiles AS p WHERE (p.id = u.id)) | 5 | 1 | 0 | 0",
+			"    -> Scan users AS u: SCAN MATCH user:*, HGETALL per key | 5 | 1 | 6 | 2",
+			"    -> Correlated subquery: SELECT city FROM profiles AS p WHERE (p.id = u.id) | 3 | 5 | 5 | 5",
+			"total | 5 | NULL | 11 | 7",
+		}},
+		// the recursive member runs once per step
+		{"WITH RECURSIVE n (i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 4) SELECT i FROM n", []string{
+			"-> Materialize recursive CTE n | 4 | 1 | 0 | 0",
+			"    -> Project: 1 | 1 | 1 | 0 | 0",
+			"        -> No table: a single row | 1 | 1 | 0 | 0",
+			"    -> Project: (i + 1) | 3 | 4 | 0 | 0",
+			"        -> Filter: (i < 4) | 3 | 4 | 0 | 0",
+			"            -> Scan n: CTE rows in memory | 4 | 4 | 0 | 0",
+			"-> Project: i | 4 | 1 | 0 | 0",
+			"    -> Scan n: CTE rows in memory | 4 | 1 | 0 | 0",
+			"total | 4 | NULL | 0 | 0",
+		}},
+	}
+	for _, tt := range tests {
+		if got := analyzeRows(t, eng, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EXPLAIN ANALYZE %s\n got %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAnalysis(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	before := mr.CommandCount()
+	res, err := eng.Query(context.Background(), "EXPLAIN ANALYZE SELECT name FROM users WHERE country = 'India' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"plan", "rows", "loops", "time (ms)", "commands", "round trips", "bytes"}
+	if !reflect.DeepEqual(res.Columns, want) {
+		t.Errorf("columns = %q, want %q", res.Columns, want)
+	}
+
+	a := res.Analysis
+	if a == nil {
+		t.Fatal("no Analysis in the result")
+	}
+	if a.Rows != 2 || a.Loops != 1 || a.Time <= 0 || len(a.Children) != 1 {
+		t.Errorf("Analysis = %+v, want 2 rows of 1 loop and one operator", a)
+	}
+	cmds, trips, bytes := a.Total()
+	if issued := int64(mr.CommandCount() - before); cmds != issued {
+		t.Errorf("Total() commands = %d, KeyDB got %d", cmds, issued)
+	}
+	last := res.Rows[len(res.Rows)-1]
+	if last[4] != cmds || last[5] != trips || last[6] != bytes {
+		t.Errorf("total row = %v, want %d commands, %d round trips, %d bytes", last, cmds, trips, bytes)
+	}
+
+	var ops []string
+	for n := a.Children[0]; n != nil; {
+		ops = append(ops, n.Operator)
+		if n.Time > a.Time {
+			t.Errorf("%s took %v, longer than the query's %v", n.Operator, n.Time, a.Time)
+		}
+		if len(n.Children) == 0 {
+			break
+		}
+		n = n.Children[0]
+	}
+	wantOps := []string{"Sort: name", "Project: name", "Filter: (country = 'India')", "Scan users: SCAN MATCH user:*, HGETALL per key"}
+	if !reflect.DeepEqual(ops, wantOps) {
+		t.Errorf("operators = %q, want %q", ops, wantOps)
+	}
+
+	// the rows of the query itself are dropped
+	if len(res.Rows) != len(wantOps)+1 {
+		t.Errorf("EXPLAIN ANALYZE returned %d rows, want %d", len(res.Rows), len(wantOps)+1)
+	}
+}
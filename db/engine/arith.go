@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// arith applies an arithmetic operator or the string concatenation ||. A
+// NULL operand makes the result NULL. Integers, and strings holding them,
+// give an integer result except for "/", which always divides exactly; a
+// division by zero is NULL, as in MySQL.
+func arith(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if op == "||" {
+		return toString(left) + toString(right), nil
+	}
+
+	if op != "/" {
+		a, okA := toInt(left)
+		b, okB := toInt(right)
+		if okA && okB {
+			var n int64
+			ok := true
+			switch op {
+			case "+":
+				n, ok = addInts(a, b)
+			case "-":
+				n, ok = subInts(a, b)
+			case "*":
+				n, ok = mulInts(a, b)
+			case "%":
+				if b == 0 {
+					return nil, nil
+				}
+				return a % b, nil
+			default:
+				return nil, &UnsupportedError{What: "operator " + op}
+			}
+			if !ok {
+				return nil, &OutOfRangeError{Expr: fmt.Sprintf("%d %s %d", a, op, b)}
+			}
+			return n, nil
+		}
+	}
+
+	a, err := number(op, left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := number(op, right)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, nil
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, nil
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, &UnsupportedError{What: "operator " + op}
+}
+
+// negate applies the sign - to a number, keeping integers integers
+func negate(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if n, ok := toInt(v); ok {
+		if n == math.MinInt64 {
+			return nil, &OutOfRangeError{Expr: fmt.Sprintf("-(%d)", n)}
+		}
+		return -n, nil
+	}
+	f, err := number("-", v)
+	if err != nil {
+		return nil, err
+	}
+	return -f, nil
+}
+
+// number converts an operand of op to a float, rejecting non-numeric values
+func number(op string, v interface{}) (float64, error) {
+	f, ok := toFloat(v)
+	if !ok {
+		return 0, &TypeMismatchError{Context: "operator " + op, Want: "a number", Value: v}
+	}
+	return f, nil
+}
+
+// addInts, subInts and mulInts compute with integers, reporting false when
+// the result doesn't fit in an int64
+func addInts(a, b int64) (int64, bool) {
+	n := a + b
+	return n, (a^n)&(b^n) >= 0
+}
+
+func subInts(a, b int64) (int64, bool) {
+	n := a - b
+	return n, (a^b)&(a^n) >= 0
+}
+
+func mulInts(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	n := a * b
+	return n, n/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "price", "2.5", "qty", "4", "big", "9223372036854775807")
+	mr.HSet("user:2", "big", "1")
+	checkQueries(t, eng, []queryTest{
+		{"SELECT age + 1, age - 1, age * 2, age % 7 FROM users WHERE id = '1'", []string{"31 | 29 | 60 | 2"}},
+		{"SELECT age / 4, -age, price * qty FROM users WHERE id = '1'", []string{"7.5 | -30 | 10"}},
+		{"SELECT 2 + 3 * 4, (2 + 3) * 4, 10 - 4 - 3 FROM users WHERE id = '1'", []string{"14 | 20 | 3"}},
+		// division by zero and NULL operands give NULL
+		{"SELECT age / 0, age % 0, age + manager_id FROM users WHERE id = '1'", []string{"NULL | NULL | NULL"}},
+		{"SELECT name FROM users WHERE age + 5 >= 40 ORDER BY name", []string{"Cid", "Dee"}},
+		{"SELECT name || ' <' || email || '>' FROM users WHERE id = '2'", []string{"Bob <bob@example.com>"}},
+		{"SELECT name || manager_id FROM users WHERE id = '1'", []string{"NULL"}},
+		// integers up to the BIGINT bounds stay exact
+		{"SELECT 9223372036854775806 + 1, -9223372036854775807 - 1, 4294967296 * 2147483647, 9223372036854775807 * -1", []string{
+			"9223372036854775807 | -9223372036854775808 | 9223372032559808512 | -9223372036854775807",
+		}},
+		{"SELECT ROUND(-15, -1), ROUND(4999999999999999999, -19), ROUND(12, -400), ROUND(2.5, 400), ROUND(2.5, -400)", []string{"-20 | 0 | 0 | 2.5 | 0"}},
+		// a SUM past the BIGINT bounds goes on as a float
+		{"SELECT SUM(big) FROM users", []string{"9223372036854776000"}},
+	})
+
+	for _, query := range []string{
+		"SELECT 9223372036854775807 + 1",
+		"SELECT -9223372036854775807 - 2",
+		"SELECT 4294967296 * 4294967296",
+		"SELECT (-9223372036854775807 - 1) * -1",
+		"SELECT -(-9223372036854775807 - 1)",
+		"SELECT ROUND(9223372036854775807, -19)",
+		"SELECT ROUND(9223372036854775807, -1)",
+	} {
+		_, err := eng.Query(context.Background(), query)
+		var overflow *OutOfRangeError
+		if !errors.As(err, &overflow) {
+			t.Errorf("%s: error = %v, want an OutOfRangeError", query, err)
+		} else if code, state := ErrorCode(err); code != 1690 || state != "22003" {
+			t.Errorf("%s: code %d (%s), want 1690 (22003)", query, code, state)
+		}
+	}
+
+	_, err := eng.Query(context.Background(), "SELECT name + 1 FROM users WHERE id = '1'")
+	var mismatch *TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("name + 1: error = %v, want a TypeMismatchError", err)
+	}
+}
+
+func TestCase(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name, CASE WHEN age > 32 THEN 'senior' WHEN age > 26 THEN 'mid' ELSE 'junior' END FROM users ORDER BY name", []string{
+			"Ann | mid", "Bob | junior", "Cid | senior", "Dee | senior", "Eve | junior",
+		}},
+		{"SELECT name, CASE country WHEN 'India' THEN 'IN' WHEN 'USA' THEN 'US' END FROM users WHERE age < 40 ORDER BY name", []string{
+			"Ann | IN", "Bob | US", "Dee | NULL",
+		}},
+		{"SELECT name FROM users WHERE CASE WHEN age IS NULL THEN 0 ELSE age END < 30 ORDER BY name", []string{"Bob", "Eve"}},
+		{"SELECT CASE WHEN age > 30 THEN 'old' ELSE 'young' END AS bracket, COUNT(*) FROM users GROUP BY bracket ORDER BY bracket", []string{
+			"old | 2", "young | 3",
+		}},
+	})
+}
+
+func TestComputedColumnNames(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	res, err := eng.Query(context.Background(), "SELECT age + 1 AS next_age, name, CASE WHEN age > 40 THEN 'senior' ELSE 'junior' END AS bracket FROM users WHERE id = '3'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"next_age", "name", "bracket"}; !reflect.DeepEqual(res.Columns, want) {
+		t.Errorf("columns = %q, want %q", res.Columns, want)
+	}
+	if want := [][]interface{}{{int64(42), "Cid", "senior"}}; !reflect.DeepEqual(res.Rows, want) {
+		t.Errorf("rows = %#v, want %#v", res.Rows, want)
+	}
+	checkQueries(t, eng, []queryTest{
+		{"SELECT age * 2 AS double FROM users WHERE age IS NOT NULL ORDER BY double DESC LIMIT 2", []string{"82", "70"}},
+	})
+}
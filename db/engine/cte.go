@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// maxRecursion bounds the steps of a recursive CTE, which would otherwise
+// never end on a cycle of keys combined with UNION ALL
+const maxRecursion = 1000
+
+// scope holds the common table expressions visible to a statement, by
+// lower-cased name, and those of the statements enclosing it
+type scope struct {
+	parent *scope
+	ctes   map[string]*cte
+}
+
+// cte is a common table expression. It is materialized the first time a
+// query reads it, and its rows are then read like hashes: every column is
+// a field holding the text of its value, and a NULL is a missing field.
+type cte struct {
+	def       *parser.CTE
+	scope     *scope // the scope of the WITH defining the CTE
+	recursive bool
+	columns   []string
+	rows      []map[string]string
+	ready     bool
+	running   bool
+}
+
+// newScope returns the scope of the CTEs of a WITH clause, nested in parent
+func newScope(parent *scope, with []*parser.CTE, recursive bool) (*scope, error) {
+	sc := &scope{parent: parent, ctes: make(map[string]*cte)}
+	for _, def := range with {
+		name := strings.ToLower(def.Name)
+		if _, ok := sc.ctes[name]; ok {
+			return nil, fmt.Errorf("CTE %s is defined more than once", def.Name)
+		}
+		sc.ctes[name] = &cte{def: def, scope: sc, recursive: recursive}
+	}
+	return sc, nil
+}
+
+// lookup returns the CTE visible under name, or nil
+func (s *scope) lookup(name string) *cte {
+	for ; s != nil; s = s.parent {
+		if c, ok := s.ctes[strings.ToLower(name)]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// materialize runs the query of a CTE. A recursive CTE runs its anchor,
+// then its recursive member over the rows of the previous step until a
+// step adds no row; with UNION rather than UNION ALL, rows already produced
+// are not added again, which also ends walks over cycles.
+func (e *Engine) materialize(ctx context.Context, c *cte) error {
+	if c.ready {
+		return nil
+	}
+	if c.running {
+		return fmt.Errorf("CTE %s refers to itself without WITH RECURSIVE", c.def.Name)
+	}
+	c.running = true
+	defer func() { c.running = false }()
+	op := "Materialize CTE " + c.def.Name
+	if c.recursive && c.def.Union != nil && refersTo(c.def.Union, c.def.Name) {
+		op = "Materialize recursive CTE " + c.def.Name
+	}
+	ctx, end := analyzeStep(ctx, op)
+
+	anchor, err := e.run(ctx, c.def.Select, c.scope)
+	if err != nil {
+		return err
+	}
+	columns := anchor.Columns
+	if len(c.def.Columns) > 0 {
+		if len(c.def.Columns) != len(columns) {
+			return fmt.Errorf("CTE %s names %d columns but its query returns %d", c.def.Name, len(c.def.Columns), len(columns))
+		}
+		columns = c.def.Columns
+	}
+
+	var all [][]interface{}
+	seen := make(map[string]bool)
+	add := func(rows [][]interface{}) [][]interface{} {
+		var added [][]interface{}
+		for _, row := range rows {
+			if !c.def.UnionAll {
+				key := e.Dialect.valueKey(row...)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			added = append(added, row)
+		}
+		all = append(all, added...)
+		return added
+	}
+	switch {
+	case c.def.Union == nil:
+		all = anchor.Rows
+	case c.recursive && refersTo(c.def.Union, c.def.Name):
+		working := add(anchor.Rows)
+		for step := 0; len(working) > 0; step++ {
+			if step == maxRecursion {
+				return fmt.Errorf("recursive CTE %s did not end after %d steps", c.def.Name, maxRecursion)
+			}
+			prev := &cte{def: c.def, columns: columns, rows: fieldRows(columns, working), ready: true}
+			sc := &scope{parent: c.scope, ctes: map[string]*cte{strings.ToLower(c.def.Name): prev}}
+			res, err := e.run(ctx, c.def.Union, sc)
+			if err != nil {
+				return err
+			}
+			if err := unionColumns(c, columns, res); err != nil {
+				return err
+			}
+			working = add(res.Rows)
+		}
+	default:
+		add(anchor.Rows)
+		res, err := e.run(ctx, c.def.Union, c.scope)
+		if err != nil {
+			return err
+		}
+		if err := unionColumns(c, columns, res); err != nil {
+			return err
+		}
+		add(res.Rows)
+	}
+
+	c.columns, c.rows, c.ready = columns, fieldRows(columns, all), true
+	end(len(all))
+	return nil
+}
+
+func unionColumns(c *cte, columns []string, res *Result) error {
+	if len(res.Columns) != len(columns) {
+		return fmt.Errorf("UNION in CTE %s combines %d columns with %d", c.def.Name, len(columns), len(res.Columns))
+	}
+	return nil
+}
+
+// fieldRows converts result rows to the fields of hash-like rows
+func fieldRows(columns []string, rows [][]interface{}) []map[string]string {
+	out := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		fields := make(map[string]string, len(columns))
+		for j, v := range row {
+			if v != nil {
+				fields[columns[j]] = toString(v)
+			}
+		}
+		out[i] = fields
+	}
+	return out
+}
+
+// refersTo reports whether sel, or a subquery in it, reads the table name
+func refersTo(sel *parser.SelectStmt, name string) bool {
+	if containsFold(tableNames(sel), name) {
+		return true
+	}
+	found := false
+	for _, expr := range stmtExprs(sel) {
+		parser.Walk(expr, func(e parser.Expr) bool {
+			if sub, ok := e.(*parser.SubqueryExpr); ok && refersTo(sub.Select, name) {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// tableNames returns the names of the tables read by sel
+func tableNames(sel *parser.SelectStmt) []string {
+	var names []string
+	if sel.From != nil {
+		names = append(names, sel.From.Name)
+	}
+	for _, j := range sel.Joins {
+		names = append(names, j.Table.Name)
+	}
+	return names
+}
+
+// inlineCTEs returns stmt with the CTEs that only filter a table, such as
+// "WITH india AS (SELECT * FROM users WHERE country='India')", replaced by
+// that table, their condition added to the WHERE clause. The query then reads
+// the table directly, using its indexes, instead of materializing the CTE.
+// The columns of the condition, which can only be those of the table, are
+// qualified with the name the query gives it, so that they don't bind to
+// another table of a join.
+func inlineCTEs(stmt *parser.SelectStmt, sc *scope) *parser.SelectStmt {
+	if sc == nil {
+		return stmt
+	}
+	out := *stmt
+	out.Joins = append([]*parser.Join(nil), stmt.Joins...)
+	inline := func(ref *parser.TableRef) *parser.TableRef {
+		c := sc.lookup(ref.Name)
+		if c == nil || !inlinable(c) || sc.lookup(c.def.Select.From.Name) != nil {
+			return ref
+		}
+		sel := c.def.Select
+		inner, outer := sel.From.RefName(), ref.RefName()
+		cond := parser.Rewrite(sel.Where, func(e parser.Expr) parser.Expr {
+			if col, ok := e.(*parser.ColumnRef); ok && (col.Table == "" || strings.EqualFold(col.Table, inner)) {
+				return &parser.ColumnRef{Table: outer, Name: col.Name}
+			}
+			return nil
+		})
+		if cond != nil {
+			if out.Where == nil {
+				out.Where = cond
+			} else {
+				out.Where = &parser.BinaryExpr{Op: "AND", Left: out.Where, Right: cond}
+			}
+		}
+		return &parser.TableRef{Name: sel.From.Name, Alias: outer}
+	}
+	if stmt.From != nil {
+		out.From = inline(stmt.From)
+	}
+	for i, j := range out.Joins {
+		out.Joins[i] = &parser.Join{Table: inline(j.Table), On: j.On}
+	}
+	return &out
+}
+
+// inlinable reports whether a CTE is a plain "SELECT * FROM table [WHERE ...]"
+func inlinable(c *cte) bool {
+	sel := c.def.Select
+	if c.def.Union != nil || len(c.def.Columns) > 0 || len(sel.With) > 0 || len(sel.Fields) != 1 {
+		return false
+	}
+	if star, ok := sel.Fields[0].Expr.(*parser.StarExpr); !ok || star.Table != "" {
+		return false
+	}
+	return sel.From != nil && !sel.Distinct && len(sel.Joins) == 0 && len(sel.GroupBy) == 0 && sel.Having == nil &&
+		len(sel.OrderBy) == 0 && sel.Limit == nil && sel.Offset == nil && !hasSubquery(sel.Where)
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCTEs(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		// a CTE that only filters a table is inlined into the query
+		{"WITH india AS (SELECT * FROM users WHERE country = 'India') SELECT name FROM india ORDER BY name", []string{"Ann", "Cid"}},
+		{"WITH india AS (SELECT * FROM users WHERE country = 'India') SELECT i.name FROM india i WHERE i.age > 35", []string{"Cid"}},
+		// profiles have a country too: the CTE's one is that of users
+		{"WITH usa AS (SELECT * FROM users WHERE country = 'USA') SELECT p.bio, u.name, u.country FROM profiles p JOIN usa u ON u.id = p.id", []string{"likes golf | Bob | USA"}},
+		{"WITH usa AS (SELECT * FROM users u WHERE u.country = 'USA') SELECT p.bio, usa.name FROM profiles p JOIN usa ON usa.id = p.id", []string{"likes golf | Bob"}},
+		// others are materialized
+		{"WITH c (country, n) AS (SELECT country, COUNT(*) FROM users GROUP BY country) SELECT country FROM c WHERE n > 1 ORDER BY country", []string{"India", "USA"}},
+		{"WITH a AS (SELECT id, name FROM users WHERE age > 30), b AS (SELECT name FROM a WHERE name <> 'Dee') SELECT name FROM b", []string{"Cid"}},
+		{"WITH old AS (SELECT id, name FROM users WHERE age >= 35) SELECT o.name, p.bio FROM old o JOIN profiles p ON p.id = o.id", []string{"Dee | likes rain"}},
+		{"WITH old AS (SELECT id FROM users WHERE age >= 35) SELECT name FROM users WHERE id IN (SELECT id FROM old) ORDER BY name", []string{"Cid", "Dee"}},
+		{"WITH c AS (SELECT name FROM users WHERE id = '1') SELECT c.name, u.name FROM c JOIN users u ON u.manager_id = '1'", []string{"Ann | Bob"}},
+	})
+}
+
+func TestRecursiveCTEs(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		// Eve's chain of managers: Dee, Bob, Ann
+		{`WITH RECURSIVE chain AS (
+			SELECT id, name, manager_id FROM users WHERE id = '5'
+			UNION ALL
+			SELECT u.id, u.name, u.manager_id FROM chain c JOIN users u ON u.id = c.manager_id
+		) SELECT name FROM chain`, []string{"Eve", "Dee", "Bob", "Ann"}},
+		{`WITH RECURSIVE n (i) AS (SELECT 1 FROM users WHERE id = '1' UNION ALL SELECT i + 1 FROM n WHERE i < 4) SELECT i FROM n`, []string{"1", "2", "3", "4"}},
+	})
+
+	// a cycle ends with UNION, which drops the rows already produced
+	mr.HSet("user:1", "manager_id", "3")
+	checkQueries(t, eng, []queryTest{
+		{`WITH RECURSIVE chain AS (
+			SELECT id, name, manager_id FROM users WHERE id = '3'
+			UNION
+			SELECT u.id, u.name, u.manager_id FROM chain c JOIN users u ON u.id = c.manager_id
+		) SELECT name FROM chain ORDER BY name`, []string{"Ann", "Bob", "Cid"}},
+	})
+}
+
+func TestRecursiveCTELimit(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "manager_id", "3")
+	_, err := eng.Query(context.Background(), `WITH RECURSIVE chain AS (
+		SELECT id, manager_id FROM users WHERE id = '3'
+		UNION ALL
+		SELECT u.id, u.manager_id FROM chain c JOIN users u ON u.id = c.manager_id
+	) SELECT id FROM chain`)
+	if err == nil {
+		t.Error("a walk around a cycle with UNION ALL ran to completion, want an error")
+	}
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"strings"
+
+	"db-parse/parser"
+)
+
+// Dialect selects the flavour of SQL an engine follows where databases differ
+type Dialect int
+
+const (
+	// Standard compares strings byte-wise, as PostgreSQL does
+	Standard Dialect = iota
+	// MySQL follows MySQL and MariaDB: strings compare, group and sort
+	// ignoring case and trailing spaces, as with their default collations,
+	// LIKE ignores case, backslashes escape characters in strings, || is OR,
+	// @@ reads server variables, and SHOW and SET statements are accepted
+	MySQL
+)
+
+func (d Dialect) String() string {
+	if d == MySQL {
+		return "MySQL"
+	}
+	return "Standard"
+}
+
+// collate returns the form strings are compared by in the dialect
+func (d Dialect) collate(s string) string {
+	if d == MySQL {
+		return strings.ToLower(strings.TrimRight(s, " "))
+	}
+	return s
+}
+
+// syntax returns the options queries of the dialect are parsed with
+func (d Dialect) syntax() parser.Options {
+	if d == MySQL {
+		return parser.MySQL
+	}
+	return parser.Options{}
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// spillTTL bounds the life of the temporary sets of SELECT DISTINCT, in case
+// the engine stops before a query removes its set
+const spillTTL = 10 * time.Minute
+
+// distinctOp drops projected rows equal to an earlier one. The rows seen are
+// remembered in memory until there are Engine.DistinctMemory of them; from
+// then on they live in a temporary KeyDB set, and each batch of rows is
+// checked with one pipelined round of SADD, which reports the new members.
+type distinctOp struct {
+	q     *query
+	child operator
+	seen  map[string]bool
+	spill string // key of the temporary set, once spilled
+	buf   []*record
+}
+
+func (d *distinctOp) next(ctx context.Context) (*record, error) {
+	if d.seen == nil && d.spill == "" {
+		d.seen = make(map[string]bool)
+	}
+	for len(d.buf) == 0 {
+		if d.spill != "" {
+			if err := d.nextBatch(ctx, nil); err != nil {
+				return nil, err
+			}
+			if len(d.buf) == 0 {
+				return nil, nil
+			}
+			break
+		}
+
+		rec, err := d.child.next(ctx)
+		if err != nil || rec == nil {
+			return nil, err
+		}
+		key := d.q.e.Dialect.valueKey(rec.values...)
+		if d.seen[key] {
+			continue
+		}
+		if limit := d.q.e.DistinctMemory; limit <= 0 || len(d.seen) < limit {
+			d.seen[key] = true
+			return rec, nil
+		}
+		if err := d.spillSeen(ctx); err != nil {
+			return nil, err
+		}
+		if err := d.nextBatch(ctx, rec); err != nil {
+			return nil, err
+		}
+	}
+	rec := d.buf[0]
+	d.buf = d.buf[1:]
+	return rec, nil
+}
+
+// spillSeen moves the rows seen so far into a new temporary set
+func (d *distinctOp) spillSeen(ctx context.Context) error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	d.spill = "tmp:distinct:" + hex.EncodeToString(id)
+
+	members := make([]interface{}, 0, len(d.seen))
+	for key := range d.seen {
+		members = append(members, key)
+	}
+	d.seen = nil
+	_, err := d.q.e.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for len(members) > 0 {
+			n := batchSize
+			if n > len(members) {
+				n = len(members)
+			}
+			pipe.SAdd(ctx, d.spill, members[:n]...)
+			members = members[n:]
+		}
+		pipe.Expire(ctx, d.spill, spillTTL)
+		return nil
+	})
+	return backendError(err)
+}
+
+// nextBatch reads up to batchSize rows, starting with first when set, and
+// buffers those not yet in the temporary set
+func (d *distinctOp) nextBatch(ctx context.Context, first *record) error {
+	var batch []*record
+	if first != nil {
+		batch = append(batch, first)
+	}
+	for len(batch) < batchSize {
+		rec, err := d.child.next(ctx)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			break
+		}
+		batch = append(batch, rec)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	cmds := make([]*redis.IntCmd, len(batch))
+	_, err := d.q.e.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, rec := range batch {
+			cmds[i] = pipe.SAdd(ctx, d.spill, d.q.e.Dialect.valueKey(rec.values...))
+		}
+		pipe.Expire(ctx, d.spill, spillTTL)
+		return nil
+	})
+	if err != nil {
+		return backendError(err)
+	}
+	for i, cmd := range cmds {
+		if cmd.Val() == 1 {
+			d.buf = append(d.buf, batch[i])
+		}
+	}
+	return nil
+}
+
+// close removes the temporary set, if the rows were spilled
+func (d *distinctOp) close(ctx context.Context) error {
+	if d.spill == "" {
+		return nil
+	}
+	spill := d.spill
+	d.spill = ""
+	return backendError(d.q.e.rdb.Del(ctx, spill).Err())
+}
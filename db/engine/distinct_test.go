@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestDistinct(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT DISTINCT country FROM users ORDER BY country", []string{"India", "UK", "USA"}},
+		{"SELECT DISTINCT country, age > 30 FROM users ORDER BY 1, 2", []string{"India | false", "India | true", "UK | true", "USA | NULL", "USA | false"}},
+		{"SELECT COUNT(DISTINCT country) FROM users", []string{"3"}},
+		{"SELECT DISTINCT manager_id FROM users ORDER BY manager_id NULLS FIRST", []string{"NULL", "1", "2", "4"}},
+	})
+
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		{"SELECT DISTINCT LOWER(country) FROM users WHERE country IN ('uk', 'UK ')", []string{"uk"}},
+	})
+}
+
+// TestDistinctSpill checks that SELECT DISTINCT gives the same rows once
+// the rows seen no longer fit in memory and move to a temporary set
+func TestDistinctSpill(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	eng.DistinctMemory = 1
+	checkQueries(t, eng, []queryTest{
+		{"SELECT DISTINCT country FROM users ORDER BY country", []string{"India", "UK", "USA"}},
+		{"SELECT DISTINCT manager_id FROM users ORDER BY manager_id NULLS FIRST", []string{"NULL", "1", "2", "4"}},
+	})
+}
+
+// TestDistinctSpillRemoved checks that the temporary set of SELECT DISTINCT
+// is removed however the query stops
+func TestDistinctSpillRemoved(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:9", "name", "Zed", "age", "n/a", "country", "Peru")
+	eng.DistinctMemory = 1
+	for _, query := range []string{
+		"SELECT DISTINCT country FROM users",
+		// the LIMIT stops reading before the input is exhausted
+		"SELECT DISTINCT country FROM users LIMIT 2",
+		// Zed's age fails the query after the rows were spilled
+		"SELECT DISTINCT country, age * 2 FROM users",
+	} {
+		_, err := eng.Query(context.Background(), query)
+		if strings.Contains(query, "age") && err == nil {
+			t.Errorf("%s: want an error", query)
+		}
+		if keys := tempKeys(mr); len(keys) > 0 {
+			t.Errorf("%s left %q in KeyDB", query, keys)
+		}
+	}
+}
+
+// tempKeys returns the temporary keys left in mr
+func tempKeys(mr *miniredis.Miniredis) []string {
+	var keys []string
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "tmp:") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// batchSize is the number of keys fetched from KeyDB per pipelined round trip
+const batchSize = 100
+
+// defaultDistinctMemory is the initial Engine.DistinctMemory
+const defaultDistinctMemory = 10000
+
+// Engine runs SQL queries against the hashes stored in KeyDB
+type Engine struct {
+	rdb    *redis.Client
+	tables map[string]*Table
+
+	// DistinctMemory is the number of distinct rows SELECT DISTINCT keeps in
+	// memory before moving them to a temporary set in KeyDB, 0 for no limit
+	DistinctMemory int
+
+	// Dialect selects how strings compare and which MySQL statements are
+	// accepted. It should be set before the engine runs queries.
+	Dialect Dialect
+
+	preparedMu sync.Mutex
+	prepared   map[preparedKey]*Stmt
+}
+
+// Table maps a SQL table onto a family of hash keys
+type Table struct {
+	Name string
+	// Pattern is the key of the row with a given id, {id} standing for the
+	// id, e.g. "user:{id}" or "user:{id}:profile". Without a pattern the
+	// keys are Prefix + id.
+	Pattern string
+	Prefix  string   // keys start with Prefix, e.g. "user:"; set from Pattern when given
+	Count   int      // when set, ids are 1..Count instead of being discovered with SCAN
+	Columns []string // fields returned for SELECT *, every hash field when empty
+	Indexes []*Index
+
+	suffix string // the end of the keys, after the id
+}
+
+// IndexKind selects how an index sorted set is laid out
+type IndexKind int
+
+const (
+	// LexIndex members, all with score 0, are IndexMember(value, id) for each
+	// row. LIKE predicates with a fixed prefix on the column are answered
+	// with ZRANGEBYLEX instead of a full scan.
+	LexIndex IndexKind = iota
+	// ScoreIndex members are the ids of the rows, scored with the numeric
+	// value of the column. Range predicates on the column are answered with
+	// ZRANGEBYSCORE, which also returns the rows in ORDER BY order.
+	ScoreIndex
+)
+
+// Index is a sorted set maintained alongside a table to look rows up by a column
+type Index struct {
+	Column string
+	Key    string
+	Kind   IndexKind
+}
+
+// IndexMember returns the sorted set member recording that the row with the
+// given id holds value in an indexed column
+func IndexMember(value, id string) string {
+	return value + "\x00" + id
+}
+
+// New returns an engine reading from rdb. The engine uses a copy of rdb
+// with a hook measuring the commands EXPLAIN ANALYZE issues.
+func New(rdb *redis.Client) *Engine {
+	rdb = rdb.WithContext(rdb.Context())
+	rdb.AddHook(analyzeHook{})
+	return &Engine{
+		rdb:            rdb,
+		tables:         make(map[string]*Table),
+		DistinctMemory: defaultDistinctMemory,
+		prepared:       make(map[preparedKey]*Stmt),
+	}
+}
+
+// AddTable registers a table, replacing any table with the same name. Its
+// Pattern must hold {id} once.
+func (e *Engine) AddTable(t *Table) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+	e.tables[strings.ToLower(t.Name)] = t
+	return nil
+}
+
+// table returns the table registered under name. Unregistered tables map to
+// the keys "<name>:<id>".
+func (e *Engine) table(name string) *Table {
+	if t, ok := e.tables[strings.ToLower(name)]; ok {
+		return t
+	}
+	return &Table{Name: name, Pattern: name + ":" + idPlaceholder, Prefix: name + ":"}
+}
+
+// index returns the index of the given kind of t on column, if any
+func (t *Table) index(column string, kind IndexKind) *Index {
+	for _, idx := range t.Indexes {
+		if idx.Column == column && idx.Kind == kind {
+			return idx
+		}
+	}
+	return nil
+}
+
+// Query parses and runs a SELECT statement, SELECTs combined with UNION,
+// INTERSECT or EXCEPT, an EXPLAIN [ANALYZE] of those, or in the MySQL
+// dialect a SHOW or SET statement, with args bound to its ? or $n
+// placeholders as by Stmt.Execute
+func (e *Engine) Query(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	stmt, err := e.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Execute(ctx, args...)
+}
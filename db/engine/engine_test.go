@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// testUsers are the rows of the users table of newTestEngine, by id
+var testUsers = map[string]map[string]string{
+	"1": {"name": "Ann", "email": "ann@example.com", "age": "30", "country": "India"},
+	"2": {"name": "Bob", "email": "bob@example.com", "age": "25", "country": "USA", "manager_id": "1"},
+	"3": {"name": "Cid", "email": "cid@example.com", "age": "41", "country": "India", "manager_id": "2"},
+	"4": {"name": "Dee", "email": "dee@example.com", "age": "35", "country": "UK", "manager_id": "2"},
+	"5": {"name": "Eve", "email": "eve@example.com", "country": "USA", "manager_id": "4"},
+}
+
+// testProfiles are the rows of the profiles table of newTestEngine, by id
+var testProfiles = map[string]map[string]string{
+	"1": {"bio": "likes tea", "city": "Pune", "country": "USA"},
+	"2": {"bio": "likes golf", "city": "Austin", "country": "USA"},
+	"4": {"bio": "likes rain", "city": "Leeds", "country": "UK"},
+}
+
+// newTestEngine returns an engine over a new miniredis holding testUsers
+// under user:{id}, with a lex index on name and a score index on age, and
+// testProfiles under user_profile:{id}
+func newTestEngine(t *testing.T) (*Engine, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	for id, fields := range testUsers {
+		for field, value := range fields {
+			mr.HSet("user:"+id, field, value)
+		}
+		mr.ZAdd("idx:user:name", 0, IndexMember(fields["name"], id))
+		if age, ok := fields["age"]; ok {
+			mr.ZAdd("idx:user:age", float(t, age), id)
+		}
+	}
+	for id, fields := range testProfiles {
+		for field, value := range fields {
+			mr.HSet("user_profile:"+id, field, value)
+		}
+	}
+
+	eng := New(rdb)
+	err := eng.AddTable(&Table{Name: "users", Pattern: "user:{id}", Indexes: []*Index{
+		{Column: "name", Key: "idx:user:name"},
+		{Column: "age", Key: "idx:user:age", Kind: ScoreIndex},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.AddTable(&Table{Name: "profiles", Pattern: "user_profile:{id}"}); err != nil {
+		t.Fatal(err)
+	}
+	return eng, mr
+}
+
+func float(t *testing.T, s string) float64 {
+	t.Helper()
+	f, ok := toFloat(s)
+	if !ok {
+		t.Fatalf("%q is not a number", s)
+	}
+	return f
+}
+
+// queryRows runs query and returns its rows, the values of each joined
+// with " | " and NULL written as such
+func queryRows(t *testing.T, eng *Engine, query string, args ...interface{}) []string {
+	t.Helper()
+	res, err := eng.Query(context.Background(), query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	rows := make([]string, len(res.Rows))
+	for i, row := range res.Rows {
+		if len(row) != len(res.Columns) {
+			t.Fatalf("%s: row %d has %d values for columns %q", query, i, len(row), res.Columns)
+		}
+		values := make([]string, len(row))
+		for j, v := range row {
+			values[j] = formatValue(v)
+		}
+		rows[i] = strings.Join(values, " | ")
+	}
+	return rows
+}
+
+// queryTest is a query and the rows it returns, in order
+type queryTest struct {
+	query string
+	want  []string
+}
+
+// checkQueries runs each test query against eng
+func checkQueries(t *testing.T, eng *Engine, tests []queryTest) {
+	t.Helper()
+	for _, tt := range tests {
+		got := queryRows(t, eng, tt.query)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s\n got %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestWhereBoolean(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE country = 'India' ORDER BY name", []string{"Ann", "Cid"}},
+		{"SELECT name FROM users WHERE country = 'UK' OR name = 'Bob' ORDER BY name", []string{"Bob", "Dee"}},
+		{"SELECT name FROM users WHERE NOT country = 'USA' ORDER BY name", []string{"Ann", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE country = 'USA' AND (name = 'Bob' OR name = 'Ann')", []string{"Bob"}},
+		{"SELECT name FROM users WHERE (country = 'USA' AND name = 'Bob') OR name = 'Ann' ORDER BY name", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users WHERE NOT (country = 'India' OR country = 'USA')", []string{"Dee"}},
+		{"SELECT u.name, p.bio FROM users u JOIN profiles p ON p.id = u.id WHERE p.city = 'Leeds' OR u.name = 'Ann' ORDER BY u.name", []string{"Ann | likes tea", "Dee | likes rain"}},
+	})
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"db-parse/parser"
+)
+
+// CodedError is implemented by the errors of the parser and the engine that
+// carry a MySQL error code: *parser.ParseError, *UnknownColumnError,
+// *UnknownTableError, *UnknownFunctionError, *GroupByError,
+// *AggregateUseError, *SubqueryRowsError, *SubqueryColumnsError,
+// *TypeMismatchError, *OutOfRangeError, *UnsupportedError and *BackendError
+type CodedError interface {
+	error
+	Code() int        // MySQL error number, such as 1064
+	SQLState() string // five-character SQLSTATE, such as "42000"
+}
+
+// ErrorCode returns the MySQL error code and SQLSTATE of err, or of any
+// error it wraps. Errors without one get those of ER_UNKNOWN_ERROR.
+func ErrorCode(err error) (int, string) {
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return coded.Code(), coded.SQLState()
+	}
+	return 1105, "HY000"
+}
+
+// UnknownColumnError reports a column that none of the tables of a query
+// has. Hash tables have every column, a missing field being NULL, so only
+// CTEs and the output columns of UNION, INTERSECT and EXCEPT report it. Its
+// MySQL error code is 1054 (ER_BAD_FIELD_ERROR).
+type UnknownColumnError struct {
+	Column string
+	Clause string // the clause using the column, such as "ORDER BY", if known
+}
+
+func (e *UnknownColumnError) Error() string {
+	if e.Clause != "" {
+		return fmt.Sprintf("unknown column %s in %s", e.Column, e.Clause)
+	}
+	return fmt.Sprintf("unknown column %s", e.Column)
+}
+
+func (e *UnknownColumnError) Code() int        { return 1054 }
+func (e *UnknownColumnError) SQLState() string { return "42S22" }
+
+// UnknownTableError reports a table qualifier, as in "x.*", naming none of
+// the tables of a query. Its MySQL error code is 1051 (ER_BAD_TABLE_ERROR).
+type UnknownTableError struct {
+	Table string
+}
+
+func (e *UnknownTableError) Error() string {
+	return fmt.Sprintf("unknown table %s", e.Table)
+}
+
+func (e *UnknownTableError) Code() int        { return 1051 }
+func (e *UnknownTableError) SQLState() string { return "42S02" }
+
+// UnknownFunctionError reports a call of a function that is neither built in
+// nor registered with RegisterFunction. Its MySQL error code is 1305
+// (ER_SP_DOES_NOT_EXIST).
+type UnknownFunctionError struct {
+	Name string
+}
+
+func (e *UnknownFunctionError) Error() string {
+	return fmt.Sprintf("unknown function %s", e.Name)
+}
+
+func (e *UnknownFunctionError) Code() int        { return 1305 }
+func (e *UnknownFunctionError) SQLState() string { return "42000" }
+
+// GroupByError reports a column, or a *, selected by an aggregating query
+// outside of an aggregate function and that it doesn't group on. Its MySQL
+// error code is 1055 (ER_WRONG_FIELD_WITH_GROUP).
+type GroupByError struct {
+	Expr parser.Expr // a *parser.ColumnRef or *parser.StarExpr
+}
+
+func (e *GroupByError) Error() string {
+	if _, ok := e.Expr.(*parser.StarExpr); ok {
+		return fmt.Sprintf("%s cannot be selected with GROUP BY or aggregate functions", e.Expr)
+	}
+	return fmt.Sprintf("column %s must appear in GROUP BY or be used in an aggregate function", e.Expr)
+}
+
+func (e *GroupByError) Code() int        { return 1055 }
+func (e *GroupByError) SQLState() string { return "42000" }
+
+// AggregateUseError reports an aggregate function where it can't be
+// computed: in WHERE, ON or GROUP BY, or inside another aggregate. Its MySQL
+// error code is 1111 (ER_INVALID_GROUP_FUNC_USE).
+type AggregateUseError struct {
+	Func   string // the aggregate function, such as "SUM"
+	Clause string // the clause it is in, or "" when not known
+	Outer  string // the aggregate function it is nested in, if any
+}
+
+func (e *AggregateUseError) Error() string {
+	switch {
+	case e.Outer != "":
+		return fmt.Sprintf("aggregate function %s cannot be nested in %s", e.Func, e.Outer)
+	case e.Clause != "":
+		return fmt.Sprintf("aggregate function %s is not allowed in %s", e.Func, e.Clause)
+	}
+	return fmt.Sprintf("aggregate function %s is not allowed here", e.Func)
+}
+
+func (e *AggregateUseError) Code() int        { return 1111 }
+func (e *AggregateUseError) SQLState() string { return "HY000" }
+
+// SubqueryRowsError reports a scalar subquery returning more than one row.
+// Its MySQL error code is 1242 (ER_SUBQUERY_NO_1_ROW).
+type SubqueryRowsError struct{}
+
+func (e *SubqueryRowsError) Error() string {
+	return "subquery returns more than one row"
+}
+
+func (e *SubqueryRowsError) Code() int        { return 1242 }
+func (e *SubqueryRowsError) SQLState() string { return "21000" }
+
+// SubqueryColumnsError reports a scalar or IN subquery returning other than
+// one column. Its MySQL error code is 1241 (ER_OPERAND_COLUMNS).
+type SubqueryColumnsError struct {
+	Columns int
+}
+
+func (e *SubqueryColumnsError) Error() string {
+	return fmt.Sprintf("subquery must return 1 column, got %d", e.Columns)
+}
+
+func (e *SubqueryColumnsError) Code() int        { return 1241 }
+func (e *SubqueryColumnsError) SQLState() string { return "21000" }
+
+// TypeMismatchError reports a value that an operator, function or clause
+// can't use, such as text in arithmetic. Its MySQL error code is 1292
+// (ER_TRUNCATED_WRONG_VALUE).
+type TypeMismatchError struct {
+	Context string      // what the value was given to: "operator +", "SUM", "LIMIT", ...
+	Want    string      // what was expected: "a number", "an integer", ...
+	Value   interface{} // the value given
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("%s expects %s, got %s", e.Context, e.Want, &parser.Literal{Value: e.Value})
+}
+
+func (e *TypeMismatchError) Code() int        { return 1292 }
+func (e *TypeMismatchError) SQLState() string { return "22007" }
+
+// OutOfRangeError reports integer arithmetic whose result doesn't fit in a
+// BIGINT, such as 9223372036854775807 + 1. Its MySQL error code is 1690
+// (ER_DATA_OUT_OF_RANGE).
+type OutOfRangeError struct {
+	Expr string // the computation, such as "9223372036854775807 + 1"
+}
+
+func (e *OutOfRangeError) Error() string {
+	return fmt.Sprintf("BIGINT value is out of range in %s", e.Expr)
+}
+
+func (e *OutOfRangeError) Code() int        { return 1690 }
+func (e *OutOfRangeError) SQLState() string { return "22003" }
+
+// UnsupportedError reports a statement, expression or operator the parser
+// accepts but the engine can't run. Its MySQL error code is 1235
+// (ER_NOT_SUPPORTED_YET).
+type UnsupportedError struct {
+	What string // such as "operator ^" or "statement SHOW PROCESSLIST"
+}
+
+func (e *UnsupportedError) Error() string {
+	return "unsupported " + e.What
+}
+
+func (e *UnsupportedError) Code() int        { return 1235 }
+func (e *UnsupportedError) SQLState() string { return "42000" }
+
+// BackendError reports a failed KeyDB command, from a lost connection to a
+// cancelled context, which it wraps. Its MySQL error code is 1030
+// (ER_GET_ERRNO, an error from the storage engine).
+type BackendError struct {
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return "keydb: " + e.Err.Error()
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BackendError) Code() int        { return 1030 }
+func (e *BackendError) SQLState() string { return "HY000" }
+
+// backendError wraps an error returned by KeyDB, nil staying nil
+func backendError(err error) error {
+	var be *BackendError
+	if err == nil || errors.As(err, &be) {
+		return err
+	}
+	return &BackendError{Err: err}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"db-parse/parser"
+)
+
+func TestErrorCodes(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	tests := []struct {
+		query string
+		code  int
+		state string
+	}{
+		{"SELECT name FROM users WHERE", 1064, "42000"},
+		{"SELECT name FROM users LEFT JOIN profiles ON users.id = profiles.id", 1064, "42000"},
+		{"WITH c AS (SELECT name FROM users) SELECT age FROM c", 1054, "42S22"},
+		{"SELECT name FROM users UNION SELECT city FROM profiles ORDER BY age", 1054, "42S22"},
+		{"SELECT x.* FROM users u WHERE id = '1'", 1051, "42S02"},
+		{"SELECT users.* FROM users u", 1051, "42S02"},
+		{"SELECT name * 2 FROM users", 1292, "22007"},
+		{"SELECT SUM(name) FROM users", 1292, "22007"},
+		{"SELECT name FROM users LIMIT 'ten'", 1292, "22007"},
+		{"SELECT NO_SUCH_FN(name) FROM users", 1305, "42000"},
+		{"SELECT country, name FROM users GROUP BY country", 1055, "42000"},
+		{"SELECT *, COUNT(*) FROM users", 1055, "42000"},
+		{"SELECT name FROM users WHERE COUNT(*) > 1", 1111, "HY000"},
+		{"SELECT SUM(COUNT(age)) FROM users", 1111, "HY000"},
+		{"SELECT name FROM users WHERE age = (SELECT age FROM users WHERE country = 'India')", 1242, "21000"},
+		{"SELECT name FROM users WHERE age = (SELECT age, name FROM users WHERE id = '1')", 1241, "21000"},
+		{"SELECT name FROM users WHERE age IN (SELECT age, name FROM users)", 1241, "21000"},
+	}
+	for _, tt := range tests {
+		_, err := eng.Query(context.Background(), tt.query)
+		if err == nil {
+			t.Errorf("%s: no error, want code %d", tt.query, tt.code)
+			continue
+		}
+		if code, state := ErrorCode(err); code != tt.code || state != tt.state {
+			t.Errorf("%s: error %q has code %d (%s), want %d (%s)", tt.query, err, code, state, tt.code, tt.state)
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	eng, mr := newTestEngine(t)
+
+	_, err := eng.Query(context.Background(), "SELECT name\nFROM users WHERE age >")
+	var perr *parser.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("error = %v, want a ParseError", err)
+	}
+	if perr.Line() != 2 || perr.Column() != 23 {
+		t.Errorf("ParseError at %d:%d, want 2:23", perr.Line(), perr.Column())
+	}
+
+	_, err = eng.Query(context.Background(), "WITH c AS (SELECT name FROM users) SELECT c.age FROM c")
+	var unknown *UnknownColumnError
+	if !errors.As(err, &unknown) || unknown.Column != "c.age" {
+		t.Errorf("error = %v, want an UnknownColumnError for c.age", err)
+	}
+
+	_, err = eng.Query(context.Background(), "SELECT u.name, p.* FROM users u JOIN profiles q ON q.id = u.id")
+	var table *UnknownTableError
+	if !errors.As(err, &table) || table.Table != "p" {
+		t.Errorf("error = %v, want an UnknownTableError for p", err)
+	}
+
+	_, err = eng.Query(context.Background(), "SELECT age + name FROM users WHERE id = '1'")
+	var mismatch *TypeMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Context != "operator +" || mismatch.Value != "Ann" {
+		t.Errorf("error = %v, want a TypeMismatchError for operator + and 'Ann'", err)
+	}
+
+	mr.Close()
+	_, err = eng.Query(context.Background(), "SELECT name FROM users")
+	var backend *BackendError
+	if !errors.As(err, &backend) {
+		t.Errorf("error = %v, want a BackendError", err)
+	}
+	if code, _ := ErrorCode(err); code != 1030 {
+		t.Errorf("ErrorCode(%v) = %d, want 1030", err, code)
+	}
+}
+
+func TestErrorCodeWrapped(t *testing.T) {
+	tests := []struct {
+		err   error
+		code  int
+		state string
+	}{
+		{&SubqueryRowsError{}, 1242, "21000"},
+		{fmt.Errorf("statement 2: %w", &UnknownColumnError{Column: "x"}), 1054, "42S22"},
+		{&BackendError{Err: context.Canceled}, 1030, "HY000"},
+		{errors.New("other"), 1105, "HY000"},
+	}
+	for _, tt := range tests {
+		if code, state := ErrorCode(tt.err); code != tt.code || state != tt.state {
+			t.Errorf("ErrorCode(%v) = %d, %s, want %d, %s", tt.err, code, state, tt.code, tt.state)
+		}
+	}
+	if err := backendError(context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("backendError(context.Canceled) = %v, want it to wrap context.Canceled", err)
+	}
+	wrapped := backendError(fmt.Errorf("scan: %w", &BackendError{Err: context.Canceled}))
+	if _, ok := wrapped.(*BackendError); ok {
+		t.Errorf("backendError wrapped a BackendError again: %v", wrapped)
+	}
+}
@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"db-parse/parser"
+)
+
+// Row holds the column values of one record, keyed by the column reference
+// as written in the query (e.g. "age" or "address.city"). Values read from
+// KeyDB hashes are strings; a missing hash field is NULL, represented by nil.
+type Row map[string]interface{}
+
+// Eval evaluates expr against row. Conditions evaluate to true, false or nil
+// when their result is unknown because of a NULL, following SQL's
+// three-valued logic. Strings compare byte-wise, as in the Standard dialect.
+func Eval(expr parser.Expr, row Row) (interface{}, error) {
+	return Standard.eval(expr, row)
+}
+
+func (d Dialect) eval(expr parser.Expr, row Row) (interface{}, error) {
+	switch e := expr.(type) {
+	case *parser.Literal:
+		return e.Value, nil
+	case *parser.ColumnRef:
+		return row[e.String()], nil
+	case *parser.UnaryExpr:
+		return d.evalUnary(e, row)
+	case *parser.BinaryExpr:
+		return d.evalBinary(e, row)
+	case *parser.InExpr:
+		return d.evalIn(e, row)
+	case *parser.BetweenExpr:
+		return d.evalBetween(e, row)
+	case *parser.LikeExpr:
+		return d.evalLike(e, row)
+	case *parser.IsNullExpr:
+		v, err := d.eval(e.Expr, row)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.Not, nil
+	case *parser.FuncCall:
+		return d.evalCall(e, row)
+	case *parser.CaseExpr:
+		return d.evalCase(e, row)
+	case *parser.VarRef:
+		return d.variable(e)
+	case *parser.Param:
+		return nil, fmt.Errorf("parameter %s is not bound", e)
+	case *parser.SubqueryExpr, *parser.ExistsExpr:
+		return nil, fmt.Errorf("subquery %s must be run by the engine", expr)
+	}
+	return nil, &UnsupportedError{What: "expression " + expr.String()}
+}
+
+// Match evaluates a condition and reports whether it holds for row. An
+// unknown result doesn't hold.
+func Match(cond parser.Expr, row Row) (bool, error) {
+	return Standard.match(cond, row)
+}
+
+func (d Dialect) match(cond parser.Expr, row Row) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+	v, err := d.eval(cond, row)
+	if err != nil {
+		return false, err
+	}
+	b, _ := truth(v)
+	return b, nil
+}
+
+// truth converts a value to a boolean, the second result is false when the
+// value is NULL. Numbers are true when non-zero.
+func truth(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case nil:
+		return false, false
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return err == nil && n != 0, true
+	}
+	return true, true
+}
+
+// evalCondition evaluates expr as a condition: true, false or nil for unknown
+func (d Dialect) evalCondition(expr parser.Expr, row Row) (interface{}, error) {
+	v, err := d.eval(expr, row)
+	if err != nil {
+		return nil, err
+	}
+	b, known := truth(v)
+	if !known {
+		return nil, nil
+	}
+	return b, nil
+}
+
+func (d Dialect) evalUnary(e *parser.UnaryExpr, row Row) (interface{}, error) {
+	switch e.Op {
+	case "NOT":
+		v, err := d.evalCondition(e.Expr, row)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return !v.(bool), nil
+	case "-", "+":
+		v, err := d.eval(e.Expr, row)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if e.Op == "-" {
+			return negate(v)
+		}
+		if n, ok := toInt(v); ok {
+			return n, nil
+		}
+		return number(e.Op, v)
+	}
+	return nil, &UnsupportedError{What: "operator " + e.Op}
+}
+
+func (d Dialect) evalBinary(e *parser.BinaryExpr, row Row) (interface{}, error) {
+	switch e.Op {
+	case "AND", "OR":
+		// Short-circuit so the right side is only evaluated when needed:
+		// false decides an AND, true decides an OR
+		decisive := e.Op == "OR"
+		left, err := d.evalCondition(e.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		if left == decisive {
+			return decisive, nil
+		}
+		right, err := d.evalCondition(e.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		if right == decisive {
+			return decisive, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return !decisive, nil
+	}
+
+	left, err := d.eval(e.Left, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := d.eval(e.Right, row)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "+", "-", "*", "/", "%", "||":
+		return arith(e.Op, left, right)
+	}
+	return d.compare(e.Op, left, right)
+}
+
+// evalCase returns the result of the first WHEN branch whose condition holds,
+// or whose value equals the operand, else the ELSE result or NULL
+func (d Dialect) evalCase(e *parser.CaseExpr, row Row) (interface{}, error) {
+	var operand interface{}
+	if e.Operand != nil {
+		v, err := d.eval(e.Operand, row)
+		if err != nil {
+			return nil, err
+		}
+		operand = v
+	}
+	for _, w := range e.Whens {
+		var holds interface{}
+		var err error
+		if e.Operand != nil {
+			var v interface{}
+			if v, err = d.eval(w.Cond, row); err == nil {
+				holds, err = d.compare("=", operand, v)
+			}
+		} else {
+			holds, err = d.evalCondition(w.Cond, row)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if holds == true {
+			return d.eval(w.Result, row)
+		}
+	}
+	if e.Else == nil {
+		return nil, nil
+	}
+	return d.eval(e.Else, row)
+}
+
+// evalIn reports whether the value equals any item of the list. Without a
+// match, a NULL in the list, or an item that can't be compared with the
+// value, makes the result unknown.
+func (d Dialect) evalIn(e *parser.InExpr, row Row) (interface{}, error) {
+	if e.Subquery != nil {
+		return nil, fmt.Errorf("subquery %s must be run by the engine", e.Subquery)
+	}
+	v, err := d.eval(e.Expr, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	sawNull := false
+	for _, item := range e.List {
+		iv, err := d.eval(item, row)
+		if err != nil {
+			return nil, err
+		}
+		eq, err := d.compare("=", v, iv)
+		if err != nil {
+			return nil, err
+		}
+		if eq == true {
+			return !e.Not, nil
+		}
+		sawNull = sawNull || eq == nil
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return e.Not, nil
+}
+
+// evalBetween reports whether low <= value <= high
+func (d Dialect) evalBetween(e *parser.BetweenExpr, row Row) (interface{}, error) {
+	v, err := d.eval(e.Expr, row)
+	if err != nil {
+		return nil, err
+	}
+	low, err := d.eval(e.Low, row)
+	if err != nil {
+		return nil, err
+	}
+	high, err := d.eval(e.High, row)
+	if err != nil {
+		return nil, err
+	}
+	aboveLow, err := d.compare(">=", v, low)
+	if err != nil {
+		return nil, err
+	}
+	belowHigh, err := d.compare("<=", v, high)
+	if err != nil {
+		return nil, err
+	}
+	if aboveLow == false || belowHigh == false {
+		return e.Not, nil
+	}
+	if aboveLow == nil || belowHigh == nil {
+		return nil, nil
+	}
+	return !e.Not, nil
+}
+
+// compare applies a comparison operator using the rules of order. The result
+// is unknown (nil) when either side is NULL or when the two values can't be
+// compared, such as 'n/a' and 5, so that NOT (a = b) and a <> b agree.
+func (d Dialect) compare(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	c, ok := d.order(left, right)
+	if !ok {
+		return nil, nil
+	}
+
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "<>", "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, &UnsupportedError{What: "operator " + op}
+}
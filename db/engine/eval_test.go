@@ -0,0 +1,115 @@
+package engine
+
+import "testing"
+
+func TestComparisons(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE age < 30", []string{"Bob"}},
+		{"SELECT name FROM users WHERE age <= 30 ORDER BY name", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users WHERE age > 35", []string{"Cid"}},
+		{"SELECT name FROM users WHERE age >= 35 ORDER BY name", []string{"Cid", "Dee"}},
+		{"SELECT name FROM users WHERE age != 30 ORDER BY name", []string{"Bob", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE age <> 30 ORDER BY name", []string{"Bob", "Cid", "Dee"}},
+		// numbers compare numerically, not as text
+		{"SELECT name FROM users WHERE age > 4 ORDER BY name", []string{"Ann", "Bob", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE age < 100 ORDER BY name", []string{"Ann", "Bob", "Cid", "Dee"}},
+		// strings compare byte-wise
+		{"SELECT name FROM users WHERE name < 'Cid' ORDER BY name", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users WHERE name >= 'c'", nil},
+		{"SELECT name FROM users WHERE 'Dee' <= name ORDER BY name", []string{"Dee", "Eve"}},
+	})
+}
+
+func TestIncomparableValues(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:6", "name", "Fay", "age", "n/a")
+	checkQueries(t, eng, []queryTest{
+		// 'n/a' can't be read as a number: every comparison with it is
+		// unknown, so <> and NOT (=) agree
+		{"SELECT name FROM users WHERE age <> 30 ORDER BY name", []string{"Bob", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE NOT (age = 30) ORDER BY name", []string{"Bob", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE (age = 30) IS NULL ORDER BY name", []string{"Eve", "Fay"}},
+		{"SELECT name FROM users WHERE age NOT IN (25, 30) ORDER BY name", []string{"Cid", "Dee"}},
+		{"SELECT name FROM users WHERE NOT (age BETWEEN 20 AND 32) ORDER BY name", []string{"Cid", "Dee"}},
+		{"SELECT name, CASE WHEN age > 30 THEN 'old' WHEN NOT (age > 30) THEN 'young' END FROM users WHERE name = 'Fay'", []string{"Fay | NULL"}},
+	})
+}
+
+func TestInAndBetween(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE country IN ('UK', 'USA') ORDER BY name", []string{"Bob", "Dee", "Eve"}},
+		{"SELECT name FROM users WHERE country NOT IN ('UK', 'USA') ORDER BY name", []string{"Ann", "Cid"}},
+		{"SELECT name FROM users WHERE age IN (25, 41) ORDER BY name", []string{"Bob", "Cid"}},
+		{"SELECT name FROM users WHERE id IN ('2', '4', '9') ORDER BY name", []string{"Bob", "Dee"}},
+		// without a match, a NULL in the list makes NOT IN unknown
+		{"SELECT name FROM users WHERE country NOT IN ('UK', NULL)", nil},
+		{"SELECT name FROM users WHERE age BETWEEN 25 AND 35 ORDER BY name", []string{"Ann", "Bob", "Dee"}},
+		{"SELECT name FROM users WHERE age NOT BETWEEN 25 AND 35 ORDER BY name", []string{"Cid"}},
+		{"SELECT name FROM users WHERE name BETWEEN 'B' AND 'D' ORDER BY name", []string{"Bob", "Cid"}},
+		{"SELECT name FROM users WHERE age BETWEEN 30 AND 40 AND country = 'India'", []string{"Ann"}},
+	})
+}
+
+func TestNullSemantics(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		// Eve has no age and Ann no manager_id: comparisons with them are unknown
+		{"SELECT name FROM users WHERE age IS NULL", []string{"Eve"}},
+		{"SELECT name FROM users WHERE age IS NOT NULL ORDER BY name", []string{"Ann", "Bob", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE age > 0 OR age <= 0 ORDER BY name", []string{"Ann", "Bob", "Cid", "Dee"}},
+		{"SELECT name FROM users WHERE NOT (age > 30) ORDER BY name", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users WHERE age > 30 OR country = 'USA' ORDER BY name", []string{"Bob", "Cid", "Dee", "Eve"}},
+		{"SELECT name FROM users WHERE NOT (age > 30 AND country = 'USA') ORDER BY name", []string{"Ann", "Bob", "Cid", "Dee"}},
+		{"SELECT name, age FROM users WHERE name = 'Eve'", []string{"Eve | NULL"}},
+		{"SELECT name, COALESCE(age, manager_id, 'none') FROM users WHERE name IN ('Ann', 'Eve') ORDER BY name", []string{"Ann | 30", "Eve | 4"}},
+		{"SELECT name, IFNULL(manager_id, 'none') FROM users WHERE name = 'Ann'", []string{"Ann | none"}},
+		{"SELECT name FROM users WHERE NULL = NULL", nil},
+	})
+}
+
+func TestTypedLiterals(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "score", "9.5", "active", "true", "joined", "2024-05-01")
+	mr.HSet("user:2", "score", "10", "active", "0", "joined", "2023-12-31 23:59:59", "nick", "O'Brien")
+	mr.HSet("user:3", "score", "1e1", "active", "1", "joined", "2024-05-01 08:00:00")
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE score > 9.75 ORDER BY name", []string{"Bob", "Cid"}},
+		{"SELECT name FROM users WHERE score = 1e1 ORDER BY name", []string{"Bob", "Cid"}},
+		{"SELECT name FROM users WHERE score < .95e1", nil},
+		{"SELECT name FROM users WHERE active = TRUE ORDER BY name", []string{"Ann", "Cid"}},
+		{"SELECT name FROM users WHERE active = FALSE", []string{"Bob"}},
+		{"SELECT name FROM users WHERE joined < DATE '2024-01-01'", []string{"Bob"}},
+		{"SELECT name FROM users WHERE joined >= DATE '2024-05-01' ORDER BY name", []string{"Ann", "Cid"}},
+		{"SELECT name FROM users WHERE joined = TIMESTAMP '2024-05-01 00:00:00'", []string{"Ann"}},
+		{"SELECT name FROM users WHERE nick = 'O''Brien'", []string{"Bob"}},
+		{"SELECT 'it''s', -1.5, TRUE, DATE '2024-05-01' FROM users WHERE id = '1'", []string{"it's | -1.5 | true | 2024-05-01"}},
+	})
+}
+
+func TestStringEscapesByDialect(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "path", `C:\path`)
+	mr.HSet("user:2", "path", "C:path")
+	checkQueries(t, eng, []queryTest{
+		{`SELECT name FROM users WHERE path = 'C:\path'`, []string{"Ann"}},
+		{`SELECT 'C:\path' = 'C:path' FROM users WHERE id = '1'`, []string{"false"}},
+	})
+
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		{`SELECT name FROM users WHERE path = 'C:\path'`, []string{"Bob"}},
+		{`SELECT name FROM users WHERE path = 'C:\\path'`, []string{"Ann"}},
+		{`SELECT 'it\'s' FROM users WHERE id = '1'`, []string{"it's"}},
+	})
+}
+
+func TestQuotedIdentifiers(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "first name", "Ann Marie", "order", "7")
+	checkQueries(t, eng, []queryTest{
+		{"select `first name`, \"order\" from USERS where id = '1'", []string{"Ann Marie | 7"}},
+		{"SELECT u.`first name` AS `full name` FROM users u WHERE u.`order` > 5", []string{"Ann Marie"}},
+	})
+}
@@ -0,0 +1,1284 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// query holds the state of a SELECT while it is planned and run
+type query struct {
+	e        *Engine
+	stmt     *parser.SelectStmt
+	sources  []*source
+	columns  []*parser.ColumnRef // every column the statement references
+	bindings map[string]*binding
+
+	groupBy    []parser.Expr      // GROUP BY with aliases and positions resolved
+	having     parser.Expr        // HAVING with aliases resolved
+	aggregates []*parser.FuncCall // distinct aggregate calls of the statement
+
+	// presorted is set when the access path already returns the rows in ORDER BY order
+	presorted bool
+
+	subs       *subqueries
+	correlated bool // some subquery refers to the columns of this query
+}
+
+// source is a table of the FROM or JOIN clauses
+type source struct {
+	ref   *parser.TableRef
+	table *Table
+	cte   *cte // set when the source is a CTE rather than hashes in KeyDB
+}
+
+// binding records where the value of a column reference comes from
+type binding struct {
+	source int      // index into query.sources, -1 for the first source holding field
+	field  string   // hash field
+	path   []string // keys inside the JSON document stored in field
+	pseudo string   // "id" or "key" for the pseudo-columns derived from the key name
+}
+
+// record is a row flowing between operators: the key and hash of each
+// source, and the projected values once the project operator has run
+type record struct {
+	keys   []string
+	fields []map[string]string
+	values []interface{}
+	row    Row
+}
+
+// operator produces records one at a time, next returns nil once exhausted
+type operator interface {
+	next(ctx context.Context) (*record, error)
+}
+
+// closer is implemented by the operators holding resources in KeyDB, which
+// close releases once the query stops: when its input is exhausted, when it
+// fails, or when a LIMIT stops reading early
+type closer interface {
+	close(ctx context.Context) error
+}
+
+// closePlan closes op and the operators below it, returning the first error
+func closePlan(ctx context.Context, op operator) error {
+	var first error
+	for op != nil {
+		if a, ok := op.(*analyzeOp); ok {
+			// the commands of an operator count towards it under EXPLAIN ANALYZE
+			ctx = context.WithValue(ctx, analysisKey{}, a.stats)
+			op = a.child
+			continue
+		}
+		if c, ok := op.(closer); ok {
+			if err := c.close(ctx); err != nil && first == nil {
+				first = err
+			}
+		}
+		in := input(op)
+		if in == nil {
+			break
+		}
+		op = *in
+	}
+	return first
+}
+
+// Select runs a parsed SELECT statement
+func (e *Engine) Select(ctx context.Context, stmt *parser.SelectStmt) (*Result, error) {
+	return e.run(ctx, stmt, nil)
+}
+
+// exec runs a SELECT or a set operation in the scope of the CTEs of the
+// statements enclosing it, or an EXPLAIN [ANALYZE], SHOW or SET statement
+func (e *Engine) exec(ctx context.Context, stmt parser.Statement, sc *scope) (*Result, error) {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		return e.run(ctx, s, sc)
+	case *parser.SetOpStmt:
+		return e.setOp(ctx, s, sc)
+	case *parser.ExplainStmt:
+		if s.Analyze {
+			return e.analyze(ctx, s, sc)
+		}
+		return e.explain(ctx, s, sc)
+	case *parser.ShowStmt:
+		return e.show(ctx, s)
+	case *parser.SetStmt:
+		return e.set(s)
+	}
+	return nil, &UnsupportedError{What: "statement " + stmt.String()}
+}
+
+// run runs a SELECT in the scope of the CTEs of the statements enclosing it
+func (e *Engine) run(ctx context.Context, stmt *parser.SelectStmt, sc *scope) (*Result, error) {
+	if len(stmt.With) > 0 {
+		var err error
+		if sc, err = newScope(sc, stmt.With, stmt.Recursive); err != nil {
+			return nil, err
+		}
+	}
+	stmt = inlineCTEs(stmt, sc)
+
+	subs := &subqueries{e: e, scope: sc, cache: make(map[string]*Result)}
+	stmt, err := subs.resolveUncorrelated(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	q, err := e.newQuery(ctx, stmt, sc, false)
+	if err != nil {
+		return nil, err
+	}
+	q.subs = subs
+	root, project, err := q.plan()
+	if err != nil {
+		return nil, err
+	}
+	if a := analyzing(ctx); a != nil && !a.leaf {
+		root = q.instrument(a, root, stmt.String())
+	}
+
+	result := &Result{}
+	err = drain(ctx, root, result)
+	if err == nil && !project.ready {
+		// the rows were never pulled, as with LIMIT 0, but a * still
+		// names the fields they hold
+		err = project.init(ctx)
+	}
+	result.Columns = project.columns
+	// however the query ends, its operators release what they hold, even
+	// when ctx was cancelled
+	if cerr := closePlan(context.WithoutCancel(ctx), root); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// drain adds the rows of op to res until op is exhausted
+func drain(ctx context.Context, op operator, res *Result) error {
+	for {
+		rec, err := op.next(ctx)
+		if err != nil || rec == nil {
+			return err
+		}
+		res.Rows = append(res.Rows, rec.values)
+	}
+}
+
+// newQuery binds the columns of a SELECT to its tables. For EXPLAIN, which
+// only plans the query, the CTEs it reads aren't materialized.
+func (e *Engine) newQuery(ctx context.Context, stmt *parser.SelectStmt, sc *scope, explain bool) (*query, error) {
+	q := &query{e: e, stmt: stmt, bindings: make(map[string]*binding)}
+
+	var refs []*parser.TableRef
+	if stmt.From != nil {
+		refs = append(refs, stmt.From)
+	} else {
+		for _, f := range stmt.Fields {
+			if _, ok := f.Expr.(*parser.StarExpr); ok {
+				return nil, fmt.Errorf("no tables used for %s", f)
+			}
+		}
+		q.sources = append(q.sources, &source{ref: &parser.TableRef{}, table: &Table{Count: 1}, cte: oneRow})
+	}
+	for _, j := range stmt.Joins {
+		refs = append(refs, j.Table)
+	}
+	for _, ref := range refs {
+		src, err := e.source(ctx, ref, sc, !explain)
+		if err != nil {
+			return nil, err
+		}
+		q.sources = append(q.sources, src)
+	}
+	for _, f := range stmt.Fields {
+		if star, ok := f.Expr.(*parser.StarExpr); ok && star.Table != "" && q.sourceIndex(star.Table) < 0 {
+			return nil, &UnknownTableError{Table: star.Table}
+		}
+	}
+
+	exprs := []parser.Expr{stmt.Where}
+	for _, f := range stmt.Fields {
+		exprs = append(exprs, f.Expr)
+	}
+	for _, j := range stmt.Joins {
+		exprs = append(exprs, j.On)
+	}
+	for _, item := range stmt.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	q.having = q.havingExpr(stmt.Having)
+	exprs = append(exprs, q.having)
+	// the subqueries left are correlated: the outer columns they use are
+	// read from the rows of this query
+	names := refNames(stmt)
+	for _, expr := range stmtExprs(stmt) {
+		parser.Walk(expr, func(e parser.Expr) bool {
+			if sub, ok := e.(*parser.SubqueryExpr); ok {
+				q.correlated = true
+				for _, col := range outerRefs(sub.Select, names) {
+					exprs = append(exprs, col)
+				}
+			}
+			return true
+		})
+	}
+	for _, expr := range exprs {
+		for _, col := range parser.Columns(expr) {
+			if _, ok := q.bindings[col.String()]; !ok {
+				b := q.resolve(col)
+				if err := q.checkColumn(col, b); err != nil {
+					return nil, err
+				}
+				q.columns = append(q.columns, col)
+				q.bindings[col.String()] = b
+			}
+		}
+	}
+
+	if err := checkFunctions(stmtExprs(stmt)); err != nil {
+		return nil, err
+	}
+	if err := q.prepareGrouping(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// plan builds the operator tree: a scan of the FROM table, one join per JOIN
+// clause, the WHERE filter, the aggregation and HAVING filter, the
+// projection, DISTINCT, the ORDER BY sort and the LIMIT.
+// When every row read becomes one output row, in order, the limit sits below
+// the projection, so that nothing past the last row needed is read from KeyDB.
+func (q *query) plan() (operator, *projectOp, error) {
+	limit, offset, err := q.limits()
+	if err != nil {
+		return nil, nil, err
+	}
+	scan := &scanOp{q: q, source: 0, keys: q.accessPath()}
+	sorted := len(q.stmt.OrderBy) > 0 && !q.presorted
+	grouped := q.grouped()
+	early := limit >= 0 && !sorted && !grouped && !q.stmt.Distinct
+	if early && q.stmt.Where == nil && len(q.stmt.Joins) == 0 {
+		scan.limit = offset + limit
+	}
+
+	var op operator = scan
+	for i, j := range q.stmt.Joins {
+		op = q.planJoin(op, i+1, j)
+	}
+	if q.stmt.Where != nil {
+		op = &filterOp{q: q, child: op, cond: q.stmt.Where}
+	}
+	if grouped {
+		op = &aggregateOp{q: q, child: op}
+		if q.having != nil {
+			op = &filterOp{q: q, child: op, cond: q.having}
+		}
+	}
+	if early {
+		op = &limitOp{child: op, limit: limit, offset: offset}
+	}
+	project := q.newProject(op)
+	op = project
+	if q.stmt.Distinct {
+		op = &distinctOp{q: q, child: op}
+	}
+	if sorted {
+		op = &sortOp{q: q, child: op, project: project, items: q.stmt.OrderBy}
+	}
+	if limit >= 0 && !early {
+		op = &limitOp{child: op, limit: limit, offset: offset}
+	}
+	return op, project, nil
+}
+
+// limits evaluates the LIMIT and OFFSET clauses, limit is -1 when there is none
+func (q *query) limits() (limit, offset int, err error) {
+	limit = -1
+	if q.stmt.Limit != nil {
+		if limit, err = countValue("LIMIT", q.stmt.Limit); err != nil {
+			return 0, 0, err
+		}
+	}
+	if q.stmt.Offset != nil {
+		if offset, err = countValue("OFFSET", q.stmt.Offset); err != nil {
+			return 0, 0, err
+		}
+	}
+	return limit, offset, nil
+}
+
+// countValue evaluates a LIMIT or OFFSET expression to a non-negative integer
+func countValue(clause string, expr parser.Expr) (int, error) {
+	v, err := Eval(expr, nil)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := toInt(v)
+	if !ok || n < 0 {
+		return 0, &TypeMismatchError{Context: clause, Want: "a non-negative integer", Value: v}
+	}
+	return int(n), nil
+}
+
+// oneRow is the table a SELECT without FROM reads: a single row without
+// columns, over which the SELECT list is evaluated once
+var oneRow = &cte{def: &parser.CTE{}, rows: []map[string]string{{}}, ready: true}
+
+// source returns the table a FROM or JOIN clause reads: a CTE in scope,
+// materialized now if materialize is set, or a table of hashes
+func (e *Engine) source(ctx context.Context, ref *parser.TableRef, sc *scope, materialize bool) (*source, error) {
+	c := sc.lookup(ref.Name)
+	if c == nil {
+		return &source{ref: ref, table: e.table(ref.Name)}, nil
+	}
+	if !materialize {
+		return &source{ref: ref, table: &Table{Name: c.def.Name, Columns: c.def.Columns}, cte: c}, nil
+	}
+	if err := e.materialize(ctx, c); err != nil {
+		return nil, err
+	}
+	t := &Table{Name: c.def.Name, Count: len(c.rows), Columns: c.columns}
+	return &source{ref: ref, table: t, cte: c}, nil
+}
+
+// sourceIndex returns the index of the source referenced as name, or -1
+func (q *query) sourceIndex(name string) int {
+	for i, s := range q.sources {
+		if strings.EqualFold(s.ref.RefName(), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolve binds a column reference. The id and key pseudo-columns hold the
+// key name without and with the table prefix. A qualifier that names no table
+// selects a field inside a JSON document, e.g. address.city.
+func (q *query) resolve(col *parser.ColumnRef) *binding {
+	src := 0
+	if len(q.sources) > 1 {
+		src = -1
+	}
+
+	if col.Table == "" {
+		if q.isPseudo(0, col.Name) {
+			return &binding{source: 0, pseudo: col.Name}
+		}
+		return &binding{source: src, field: col.Name}
+	}
+	if i := q.sourceIndex(col.Table); i >= 0 {
+		if q.isPseudo(i, col.Name) {
+			return &binding{source: i, pseudo: col.Name}
+		}
+		return &binding{source: i, field: col.Name}
+	}
+	return &binding{source: src, field: col.Table, path: []string{col.Name}}
+}
+
+// checkColumn rejects a column that the CTEs the query reads don't have, and
+// matches the name of those they have regardless of case. Hash tables have
+// every column. Unqualified names may also be SELECT list aliases, used in
+// GROUP BY and ORDER BY.
+func (q *query) checkColumn(col *parser.ColumnRef, b *binding) error {
+	if b.pseudo != "" {
+		return nil
+	}
+	if col.Table == "" {
+		for _, f := range q.stmt.Fields {
+			if f.Alias != "" && strings.EqualFold(f.Alias, col.Name) {
+				return nil
+			}
+		}
+	}
+	sources := q.sources
+	if b.source >= 0 {
+		sources = sources[b.source : b.source+1]
+	}
+	for _, src := range sources {
+		if src.cte == nil || !src.cte.ready {
+			return nil // the columns of a CTE are only known once it has run
+		}
+		for _, name := range src.cte.columns {
+			if strings.EqualFold(name, b.field) {
+				if len(sources) == 1 {
+					b.field = name
+				}
+				return nil
+			}
+		}
+	}
+	return &UnknownColumnError{Column: col.String()}
+}
+
+// isPseudo reports whether name is a pseudo-column of source i. The rows of a
+// CTE have no key, so id and key are ordinary columns there.
+func (q *query) isPseudo(i int, name string) bool {
+	return (name == "id" || name == "key") && q.sources[i].cte == nil
+}
+
+// value reads a bound column from a record, nil when it is absent
+func (q *query) value(rec *record, b *binding) interface{} {
+	if b.source >= 0 {
+		return q.sourceValue(rec, b.source, b)
+	}
+	for i := range q.sources {
+		if v := q.sourceValue(rec, i, b); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func (q *query) sourceValue(rec *record, i int, b *binding) interface{} {
+	fields := rec.fields[i]
+	if fields == nil {
+		return nil
+	}
+	switch b.pseudo {
+	case "key":
+		return rec.keys[i]
+	case "id":
+		id, _ := q.sources[i].table.id(rec.keys[i])
+		return id
+	}
+	raw, ok := fields[b.field]
+	if !ok {
+		return nil
+	}
+	if len(b.path) == 0 {
+		return raw
+	}
+	return jsonPath(raw, b.path)
+}
+
+// jsonPath extracts a nested value from a JSON document, following object
+// keys and, in arrays, indexes. Scalars come back as strings like any other
+// hash value, objects and arrays as JSON text.
+func jsonPath(doc string, path []string) interface{} {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	text, _ := json.Marshal(v)
+	return string(text)
+}
+
+// row returns the values of every referenced column of rec, for evaluating expressions
+func (q *query) row(rec *record) Row {
+	if rec.row == nil {
+		rec.row = make(Row, len(q.columns))
+		for _, col := range q.columns {
+			rec.row[col.String()] = q.value(rec, q.bindings[col.String()])
+		}
+	}
+	return rec.row
+}
+
+// eval evaluates expr for rec, running the correlated subqueries it contains
+func (q *query) eval(ctx context.Context, expr parser.Expr, rec *record) (interface{}, error) {
+	expr, err := q.bindSubqueries(ctx, expr, rec)
+	if err != nil {
+		return nil, err
+	}
+	return q.e.Dialect.eval(expr, q.row(rec))
+}
+
+// match reports whether rec satisfies cond, running the correlated
+// subqueries it contains. Those are only run once the conjuncts without
+// subqueries hold.
+func (q *query) match(ctx context.Context, cond parser.Expr, rec *record) (bool, error) {
+	if !q.correlated || !hasSubquery(cond) {
+		return q.e.Dialect.match(cond, q.row(rec))
+	}
+	var deferred []parser.Expr
+	for _, c := range conjuncts(cond) {
+		if hasSubquery(c) {
+			deferred = append(deferred, c)
+			continue
+		}
+		if ok, err := q.e.Dialect.match(c, q.row(rec)); err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, c := range deferred {
+		c, err := q.bindSubqueries(ctx, c, rec)
+		if err != nil {
+			return false, err
+		}
+		if ok, err := q.e.Dialect.match(c, q.row(rec)); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// bindSubqueries replaces the correlated subqueries of expr with their
+// result for the outer values of rec
+func (q *query) bindSubqueries(ctx context.Context, expr parser.Expr, rec *record) (parser.Expr, error) {
+	if !q.correlated || !hasSubquery(expr) {
+		return expr, nil
+	}
+	row := q.row(rec)
+	names := refNames(q.stmt)
+	return q.subs.replace(ctx, expr, func(sel *parser.SelectStmt) *parser.SelectStmt {
+		return bindOuter(sel, row, names)
+	})
+}
+
+func (q *query) newRecord() *record {
+	return &record{
+		keys:   make([]string, len(q.sources)),
+		fields: make([]map[string]string, len(q.sources)),
+	}
+}
+
+// extend returns a copy of rec with the row of source i attached
+func (q *query) extend(rec *record, i int, key string, fields map[string]string) *record {
+	out := q.newRecord()
+	copy(out.keys, rec.keys)
+	copy(out.fields, rec.fields)
+	out.keys[i] = key
+	out.fields[i] = fields
+	return out
+}
+
+// accessPath picks how the keys of the FROM table are found. Equality with
+// the id or key pseudo-columns reads the keys directly, a LIKE with a fixed
+// prefix on them narrows the key scan and one on an indexed column becomes an
+// index range lookup. The full WHERE clause is still applied to the rows found.
+func (q *query) accessPath() keyIterator {
+	t := q.sources[0].table
+	for _, cond := range conjuncts(q.stmt.Where) {
+		if ids, ok := q.keyEquality(cond); ok {
+			return &listKeys{ids: ids}
+		}
+
+		// key scans and lex indexes compare bytes, so they would miss the
+		// case variants that LIKE matches in the MySQL dialect
+		like, ok := cond.(*parser.LikeExpr)
+		if !ok || like.Op != "LIKE" || like.Not || q.e.Dialect == MySQL {
+			continue
+		}
+		col, isCol := like.Expr.(*parser.ColumnRef)
+		pattern, isLit := like.Pattern.(*parser.Literal)
+		if !isCol || !isLit {
+			continue
+		}
+		text, ok := pattern.Value.(string)
+		if !ok {
+			continue
+		}
+		escape := defaultEscape
+		if like.Escape != nil {
+			lit, ok := like.Escape.(*parser.Literal)
+			if !ok {
+				continue
+			}
+			es := []rune(toString(lit.Value))
+			if len(es) != 1 {
+				continue
+			}
+			escape = es[0]
+		}
+
+		b := q.bindings[col.String()]
+		if b.source != 0 || len(b.path) > 0 {
+			continue
+		}
+		prefix, exact := likePrefix(text, escape)
+		switch b.pseudo {
+		case "key":
+			switch {
+			case strings.HasPrefix(prefix, t.Prefix) && t.suffix == "":
+				return q.idKeys(strings.TrimPrefix(prefix, t.Prefix))
+			case strings.HasPrefix(prefix, t.Prefix) && t.Count == 0:
+				// the prefix may run past the id, into the end of the key
+				return &scanKeys{rdb: q.e.rdb, table: t, match: globEscape(prefix) + "*"}
+			case !strings.HasPrefix(t.Prefix, prefix):
+				return &rangeKeys{} // no key of the table can match
+			}
+		case "id":
+			if prefix != "" {
+				return q.idKeys(prefix)
+			}
+		default:
+			if idx := t.index(b.field, LexIndex); idx != nil && prefix != "" {
+				min, max := "["+prefix, "("+prefix+"\xff"
+				if exact {
+					min, max = "["+prefix+"\x00", "("+prefix+"\x01"
+				}
+				return &indexKeys{rdb: q.e.rdb, index: idx, min: min, max: max}
+			}
+		}
+	}
+	if keys := q.scoreRange(); keys != nil {
+		return keys
+	}
+	return q.idKeys("")
+}
+
+// scoreRange looks for numeric range predicates on a column of the FROM table
+// with a score index, and returns an index range lookup for them. Rows whose
+// column is NULL or not numeric aren't in the index, which is fine because
+// they can't satisfy the predicate either. The index preferred is the one on
+// the ORDER BY column, whose ordering then makes the sort unnecessary.
+func (q *query) scoreRange() keyIterator {
+	t := q.sources[0].table
+	var candidates []string
+	if len(q.stmt.OrderBy) == 1 && !q.grouped() {
+		if col, ok := q.stmt.OrderBy[0].Expr.(*parser.ColumnRef); ok {
+			candidates = append(candidates, col.String())
+		}
+	}
+	for _, col := range q.columns {
+		candidates = append(candidates, col.String())
+	}
+
+	for _, name := range candidates {
+		b := q.bindings[name]
+		if b == nil || b.source != 0 || b.pseudo != "" || len(b.path) > 0 {
+			continue
+		}
+		idx := t.index(b.field, ScoreIndex)
+		if idx == nil {
+			continue
+		}
+		min, max, ok := scoreBounds(q.stmt.Where, name)
+		if !ok {
+			continue
+		}
+
+		keys := &indexKeys{rdb: q.e.rdb, index: idx, min: min, max: max}
+		if len(q.stmt.OrderBy) == 1 && !q.grouped() && q.stmt.OrderBy[0].Expr.String() == name && q.ordersBySource(b) {
+			keys.reverse = q.stmt.OrderBy[0].Desc
+			q.presorted = true
+		}
+		return keys
+	}
+	return nil
+}
+
+// ordersBySource reports whether the ORDER BY column bound to b sorts by
+// that source column. A bare name sorts by the output column it names, as
+// in sortOp.sortValue, which may be an alias of another expression, such as
+// "0 - age AS age", or a field of another table expanded from its *.
+func (q *query) ordersBySource(b *binding) bool {
+	col := q.stmt.OrderBy[0].Expr.(*parser.ColumnRef)
+	if col.Table != "" {
+		return true
+	}
+	for _, f := range q.stmt.Fields {
+		if star, ok := f.Expr.(*parser.StarExpr); ok {
+			if star.Table != "" && q.sourceIndex(star.Table) != b.source {
+				return false
+			}
+			if declared := q.sources[b.source].table.Columns; len(declared) == 0 || containsFold(declared, b.field) {
+				return true // the fields of the source itself come first
+			}
+			continue
+		}
+		if !strings.EqualFold(q.columnName(f), col.Name) {
+			continue
+		}
+		ref, ok := f.Expr.(*parser.ColumnRef)
+		if !ok {
+			return false
+		}
+		other := q.bindings[ref.String()]
+		return other != nil && other.source == b.source && other.field == b.field &&
+			other.pseudo == "" && len(other.path) == 0
+	}
+	return true
+}
+
+// scoreBounds derives ZRANGEBYSCORE bounds for a column from the comparisons
+// and BETWEENs with numeric literals among the conjuncts of where
+func scoreBounds(where parser.Expr, column string) (string, string, bool) {
+	min, max := "-inf", "+inf"
+	minVal, maxVal := math.Inf(-1), math.Inf(1)
+	found := false
+
+	lower := func(v float64, inclusive bool) {
+		if v > minVal || v == minVal && !inclusive {
+			minVal, min = v, scoreBound(v, inclusive)
+		}
+	}
+	upper := func(v float64, inclusive bool) {
+		if v < maxVal || v == maxVal && !inclusive {
+			maxVal, max = v, scoreBound(v, inclusive)
+		}
+	}
+
+	for _, cond := range conjuncts(where) {
+		switch c := cond.(type) {
+		case *parser.BinaryExpr:
+			op := c.Op
+			col, lit := c.Left, c.Right
+			if _, ok := col.(*parser.ColumnRef); !ok {
+				col, lit, op = c.Right, c.Left, flipComparison(op)
+			}
+			v, ok := numericLiteral(lit)
+			if !ok || col.String() != column {
+				continue
+			}
+			switch op {
+			case "=":
+				lower(v, true)
+				upper(v, true)
+			case ">", ">=":
+				lower(v, op == ">=")
+			case "<", "<=":
+				upper(v, op == "<=")
+			default:
+				continue
+			}
+			found = true
+		case *parser.BetweenExpr:
+			low, lok := numericLiteral(c.Low)
+			high, hok := numericLiteral(c.High)
+			if c.Not || !lok || !hok || c.Expr.String() != column {
+				continue
+			}
+			lower(low, true)
+			upper(high, true)
+			found = true
+		}
+	}
+	return min, max, found
+}
+
+func scoreBound(v float64, inclusive bool) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if inclusive {
+		return s
+	}
+	return "(" + s
+}
+
+// flipComparison returns the operator for the same comparison with its sides swapped
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+func numericLiteral(expr parser.Expr) (float64, bool) {
+	lit, ok := expr.(*parser.Literal)
+	if !ok || !isNumber(lit.Value) {
+		return 0, false
+	}
+	return toFloat(lit.Value)
+}
+
+// keyEquality recognizes "id = 'x'", "key = 'prefix:x'" and their IN forms
+// on the FROM table, returning the ids they select
+func (q *query) keyEquality(cond parser.Expr) ([]string, bool) {
+	var col parser.Expr
+	var values []parser.Expr
+	switch c := cond.(type) {
+	case *parser.BinaryExpr:
+		if c.Op != "=" {
+			return nil, false
+		}
+		col, values = c.Left, []parser.Expr{c.Right}
+	case *parser.InExpr:
+		if c.Not || c.Subquery != nil {
+			return nil, false
+		}
+		col, values = c.Expr, c.List
+	default:
+		return nil, false
+	}
+
+	ref, ok := col.(*parser.ColumnRef)
+	if !ok {
+		return nil, false
+	}
+	b := q.bindings[ref.String()]
+	if b.source != 0 || b.pseudo == "" {
+		return nil, false
+	}
+
+	t := q.sources[0].table
+	ids := []string{}
+	for _, v := range values {
+		lit, ok := v.(*parser.Literal)
+		if !ok {
+			return nil, false
+		}
+		if lit.Value == nil {
+			continue
+		}
+		id := toString(lit.Value)
+		if b.pseudo == "key" {
+			if id, ok = t.id(id); !ok {
+				continue // not a key of this table
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// idKeys iterates the ids of the FROM table that start with prefix
+func (q *query) idKeys(prefix string) keyIterator {
+	return q.sourceKeys(0, prefix)
+}
+
+// sourceKeys returns the ids of the rows of source i starting with prefix
+func (q *query) sourceKeys(i int, prefix string) keyIterator {
+	t := q.sources[i].table
+	if t.Count > 0 || q.sources[i].cte != nil {
+		return &rangeKeys{prefix: prefix, count: t.Count}
+	}
+	return &scanKeys{rdb: q.e.rdb, table: t, match: t.match(prefix)}
+}
+
+// fetch reads the rows of source i stored under keys, nil for those missing.
+// The rows of a CTE are numbered from 1 and read from memory.
+func (q *query) fetch(ctx context.Context, i int, keys []string) ([]map[string]string, error) {
+	c := q.sources[i].cte
+	if c == nil {
+		return q.e.hashes(ctx, keys)
+	}
+	rows := make([]map[string]string, len(keys))
+	for j, key := range keys {
+		if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(c.rows) {
+			rows[j] = c.rows[n-1]
+		}
+	}
+	return rows, nil
+}
+
+// conjuncts splits an expression on its top-level ANDs
+func conjuncts(expr parser.Expr) []parser.Expr {
+	if b, ok := expr.(*parser.BinaryExpr); ok && b.Op == "AND" {
+		return append(conjuncts(b.Left), conjuncts(b.Right)...)
+	}
+	if expr == nil {
+		return nil
+	}
+	return []parser.Expr{expr}
+}
+
+// planJoin joins source i to the rows of op. An ON clause equating the id or
+// key of the joined table with a column of the tables before it becomes a
+// direct key lookup; any other condition is evaluated for every pair of rows.
+func (q *query) planJoin(op operator, i int, j *parser.Join) operator {
+	if b, ok := j.On.(*parser.BinaryExpr); ok && b.Op == "=" {
+		left, lok := b.Left.(*parser.ColumnRef)
+		right, rok := b.Right.(*parser.ColumnRef)
+		if lok && rok {
+			for _, pair := range [][2]*parser.ColumnRef{{left, right}, {right, left}} {
+				inner, outer := q.bindings[pair[0].String()], q.bindings[pair[1].String()]
+				if inner.source == i && inner.pseudo != "" && outer.source >= 0 && outer.source < i {
+					return &lookupJoinOp{q: q, child: op, source: i, inner: inner, outer: outer}
+				}
+			}
+		}
+	}
+	return &nestedLoopJoinOp{q: q, child: op, source: i, on: j.On}
+}
+
+// scanOp reads the rows of a table, one pipelined batch of keys at a time
+type scanOp struct {
+	q      *query
+	source int
+	keys   keyIterator
+	buf    []*record
+
+	// limit, when set, is the number of rows the query can still use: every
+	// row scanned is returned, so batches are cut to what is left to read
+	limit int
+	read  int
+}
+
+func (s *scanOp) next(ctx context.Context) (*record, error) {
+	t := s.q.sources[s.source].table
+	for len(s.buf) == 0 {
+		n := batchSize
+		if s.limit > 0 {
+			if s.read >= s.limit {
+				return nil, nil
+			}
+			if n > s.limit-s.read {
+				n = s.limit - s.read
+			}
+		}
+		ids, err := s.keys.next(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		if ids == nil {
+			return nil, nil
+		}
+
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = t.key(id)
+		}
+		hashes, err := s.q.fetch(ctx, s.source, keys)
+		if err != nil {
+			return nil, err
+		}
+		for i, fields := range hashes {
+			if fields != nil {
+				s.buf = append(s.buf, s.q.extend(s.q.newRecord(), s.source, keys[i], fields))
+				s.read++
+			}
+		}
+	}
+	rec := s.buf[0]
+	s.buf = s.buf[1:]
+	return rec, nil
+}
+
+// lookupJoinOp joins each row to the row of the joined table whose id (or
+// key) is the value of a column of the row
+type lookupJoinOp struct {
+	q      *query
+	child  operator
+	source int
+	inner  *binding
+	outer  *binding
+	buf    []*record
+	done   bool
+}
+
+func (l *lookupJoinOp) next(ctx context.Context) (*record, error) {
+	for len(l.buf) == 0 {
+		if l.done {
+			return nil, nil
+		}
+
+		// Look the joined rows of a whole batch up in one round trip
+		var batch []*record
+		var keys []string
+		for len(batch) < batchSize {
+			rec, err := l.child.next(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if rec == nil {
+				l.done = true
+				break
+			}
+			v := l.q.value(rec, l.outer)
+			if v == nil {
+				continue
+			}
+			key := toString(v)
+			if l.inner.pseudo == "id" {
+				key = l.q.sources[l.source].table.key(key)
+			}
+			batch = append(batch, rec)
+			keys = append(keys, key)
+		}
+
+		hashes, err := l.q.fetch(ctx, l.source, keys)
+		if err != nil {
+			return nil, err
+		}
+		for i, fields := range hashes {
+			if fields != nil {
+				l.buf = append(l.buf, l.q.extend(batch[i], l.source, keys[i], fields))
+			}
+		}
+	}
+	rec := l.buf[0]
+	l.buf = l.buf[1:]
+	return rec, nil
+}
+
+// nestedLoopJoinOp pairs each row with every row of the joined table and
+// keeps the pairs satisfying the ON condition
+type nestedLoopJoinOp struct {
+	q      *query
+	child  operator
+	source int
+	on     parser.Expr
+	inner  []*record
+	loaded bool
+	outer  *record
+	pos    int
+}
+
+func (n *nestedLoopJoinOp) next(ctx context.Context) (*record, error) {
+	if !n.loaded {
+		scan := &scanOp{q: n.q, source: n.source, keys: n.q.sourceKeys(n.source, "")}
+		for {
+			rec, err := scan.next(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if rec == nil {
+				break
+			}
+			n.inner = append(n.inner, rec)
+		}
+		n.loaded = true
+	}
+
+	for {
+		if n.outer == nil || n.pos >= len(n.inner) {
+			rec, err := n.child.next(ctx)
+			if err != nil || rec == nil {
+				return nil, err
+			}
+			n.outer, n.pos = rec, 0
+		}
+		for n.pos < len(n.inner) {
+			inner := n.inner[n.pos]
+			n.pos++
+			rec := n.q.extend(n.outer, n.source, inner.keys[n.source], inner.fields[n.source])
+			ok, err := n.q.match(ctx, n.on, rec)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return rec, nil
+			}
+		}
+	}
+}
+
+// filterOp keeps the rows satisfying a condition
+type filterOp struct {
+	q     *query
+	child operator
+	cond  parser.Expr
+}
+
+func (f *filterOp) next(ctx context.Context) (*record, error) {
+	for {
+		rec, err := f.child.next(ctx)
+		if err != nil || rec == nil {
+			return nil, err
+		}
+		ok, err := f.q.match(ctx, f.cond, rec)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+}
+
+// projectOp computes the SELECT list of each row
+type projectOp struct {
+	q       *query
+	child   operator
+	columns []string
+	items   []projectItem
+	pending []*record
+	ready   bool
+}
+
+// projectItem is one output column: an expression, or a hash field of a
+// source when expanded from *
+type projectItem struct {
+	expr   parser.Expr
+	source int
+	field  string
+}
+
+func (p *projectOp) next(ctx context.Context) (*record, error) {
+	if !p.ready {
+		if err := p.init(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var rec *record
+	if len(p.pending) > 0 {
+		rec, p.pending = p.pending[0], p.pending[1:]
+	} else {
+		var err error
+		if rec, err = p.child.next(ctx); err != nil || rec == nil {
+			return nil, err
+		}
+	}
+
+	rec.values = make([]interface{}, len(p.items))
+	for i, item := range p.items {
+		if item.expr == nil {
+			if fields := rec.fields[item.source]; fields != nil {
+				if v, ok := fields[item.field]; ok {
+					rec.values[i] = v
+				}
+			}
+			continue
+		}
+		v, err := p.q.eval(ctx, item.expr, rec)
+		if err != nil {
+			return nil, err
+		}
+		rec.values[i] = v
+	}
+	return rec, nil
+}
+
+// newProject returns the project operator of the query over child. The SELECT
+// list is expanded now, except a * over a table without declared columns,
+// which returns every field found in its rows: those rows are read first,
+// when the operator is first pulled.
+func (q *query) newProject(child operator) *projectOp {
+	p := &projectOp{q: q, child: child}
+	for _, f := range q.stmt.Fields {
+		if star, ok := f.Expr.(*parser.StarExpr); ok {
+			for _, i := range p.starSources(star) {
+				if len(q.sources[i].table.Columns) == 0 {
+					return p
+				}
+			}
+		}
+	}
+	p.expand(nil)
+	p.ready = true
+	return p
+}
+
+// init reads the rows of the child to find the fields a * over a table
+// without declared columns expands to, then expands the SELECT list
+func (p *projectOp) init(ctx context.Context) error {
+	p.ready = true
+
+	var undeclared []int
+	for _, f := range p.q.stmt.Fields {
+		if star, ok := f.Expr.(*parser.StarExpr); ok {
+			for _, i := range p.starSources(star) {
+				if len(p.q.sources[i].table.Columns) == 0 {
+					undeclared = append(undeclared, i)
+				}
+			}
+		}
+	}
+
+	found := make(map[int][]string)
+	seen := make(map[int]map[string]bool)
+	for _, i := range undeclared {
+		seen[i] = make(map[string]bool)
+	}
+	for {
+		rec, err := p.child.next(ctx)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			break
+		}
+		p.pending = append(p.pending, rec)
+		for _, i := range undeclared {
+			for field := range rec.fields[i] {
+				if !seen[i][field] {
+					seen[i][field] = true
+					found[i] = append(found[i], field)
+				}
+			}
+		}
+	}
+	for _, i := range undeclared {
+		sort.Strings(found[i])
+	}
+	p.expand(found)
+	return nil
+}
+
+// expand sets the output columns of the SELECT list, a * over a table
+// without declared columns expanding to the fields found for it
+func (p *projectOp) expand(found map[int][]string) {
+	for _, f := range p.q.stmt.Fields {
+		star, ok := f.Expr.(*parser.StarExpr)
+		if !ok {
+			p.items = append(p.items, projectItem{expr: f.Expr})
+			p.columns = append(p.columns, p.q.columnName(f))
+			continue
+		}
+		for _, i := range p.starSources(star) {
+			columns := p.q.sources[i].table.Columns
+			if len(columns) == 0 {
+				columns = found[i]
+			}
+			for _, field := range columns {
+				p.items = append(p.items, projectItem{source: i, field: field})
+				p.columns = append(p.columns, field)
+			}
+		}
+	}
+}
+
+// columnName names the output column of a SELECT list entry. Columns are
+// named without their table qualifier, nested JSON fields keep their path.
+func (q *query) columnName(f *parser.SelectField) string {
+	if col, ok := f.Expr.(*parser.ColumnRef); ok && f.Alias == "" {
+		if b := q.bindings[col.String()]; len(b.path) == 0 {
+			return col.Name
+		}
+	}
+	return f.Name()
+}
+
+// starSources returns the sources a * expands to, a qualifier having been
+// checked by newQuery
+func (p *projectOp) starSources(star *parser.StarExpr) []int {
+	if star.Table != "" {
+		return []int{p.q.sourceIndex(star.Table)}
+	}
+	all := make([]int, len(p.q.sources))
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
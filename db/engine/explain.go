@@ -0,0 +1,571 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// planNode is an operator of the plan shown by EXPLAIN, with estimates of
+// the rows it returns and of the KeyDB commands and round trips it issues
+// itself. The estimates are upper bounds: a LIMIT usually stops a query
+// before it reads every row it could.
+type planNode struct {
+	op       string
+	rows     int64
+	cmds     int64
+	trips    int64
+	runs     int64 // times the operator runs, with those below it; 0 for once
+	children []*planNode
+}
+
+// explainer plans a statement for EXPLAIN without running it. It only asks
+// KeyDB for sizes: that of the keyspace, which a SCAN walks entirely, and
+// those of the tables and index ranges read.
+type explainer struct {
+	e      *Engine
+	dbsize int64            // keys in the database, -1 until asked
+	sizes  map[string]int64 // estimated rows of the tables, by key pattern
+	ctes   map[*cte]int64   // estimated rows of the CTEs already planned
+}
+
+// explain runs EXPLAIN: the plan of the query as one row per operator,
+// indented under the operator reading its rows, and a last row with the
+// total commands and round trips the query would issue
+func (e *Engine) explain(ctx context.Context, s *parser.ExplainStmt, sc *scope) (*Result, error) {
+	x := &explainer{e: e, dbsize: -1, sizes: make(map[string]int64), ctes: make(map[*cte]int64)}
+	root, err := x.statement(ctx, s.Stmt, sc)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Columns: []string{"plan", "rows", "commands", "round trips"}}
+	cmds, trips := render(result, root, 0, 1)
+	result.Rows = append(result.Rows, []interface{}{"total", nil, cmds, trips})
+	return result, nil
+}
+
+// render adds the rows of n and of the operators below it to res, and
+// returns their commands and round trips for runs runs of n
+func render(res *Result, n *planNode, depth int, runs int64) (cmds, trips int64) {
+	if n.runs > 0 {
+		runs *= n.runs
+	}
+	res.Rows = append(res.Rows, []interface{}{strings.Repeat("    ", depth) + "-> " + n.op, n.rows, n.cmds, n.trips})
+	cmds, trips = n.cmds*runs, n.trips*runs
+	for _, child := range n.children {
+		c, t := render(res, child, depth+1, runs)
+		cmds += c
+		trips += t
+	}
+	return cmds, trips
+}
+
+func (x *explainer) statement(ctx context.Context, stmt parser.Statement, sc *scope) (*planNode, error) {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		return x.query(ctx, s, sc)
+	case *parser.SetOpStmt:
+		return x.setOp(ctx, s, sc)
+	}
+	return nil, fmt.Errorf("EXPLAIN does not support %s", stmt)
+}
+
+// query plans a SELECT as run does, and adds the plans of its subqueries
+func (x *explainer) query(ctx context.Context, stmt *parser.SelectStmt, sc *scope) (*planNode, error) {
+	if len(stmt.With) > 0 {
+		var err error
+		if sc, err = newScope(sc, stmt.With, stmt.Recursive); err != nil {
+			return nil, err
+		}
+	}
+	stmt = inlineCTEs(stmt, sc)
+	q, err := x.e.newQuery(ctx, stmt, sc, true)
+	if err != nil {
+		return nil, err
+	}
+	root, _, err := q.plan()
+	if err != nil {
+		return nil, err
+	}
+	node, err := x.operator(ctx, q, root)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := x.subqueries(ctx, q, sc, maxRows(node))
+	if err != nil {
+		return nil, err
+	}
+	node.children = append(node.children, subs...)
+	return node, nil
+}
+
+// setOp plans both queries of a UNION, INTERSECT or EXCEPT, which are then
+// combined in memory
+func (x *explainer) setOp(ctx context.Context, s *parser.SetOpStmt, sc *scope) (*planNode, error) {
+	if len(s.With) > 0 {
+		var err error
+		if sc, err = newScope(sc, s.With, s.Recursive); err != nil {
+			return nil, err
+		}
+	}
+	left, err := x.statement(ctx, s.Left, sc)
+	if err != nil {
+		return nil, err
+	}
+	right, err := x.statement(ctx, s.Right, sc)
+	if err != nil {
+		return nil, err
+	}
+	op := s.Op
+	if s.All {
+		op += " ALL"
+	}
+	node := &planNode{op: op, rows: left.rows, children: []*planNode{left, right}}
+	switch s.Op {
+	case "UNION":
+		node.rows += right.rows
+	case "INTERSECT":
+		node.rows = min(left.rows, right.rows)
+	}
+	if len(s.OrderBy) > 0 {
+		node = &planNode{op: "Sort: " + orderItems(s.OrderBy), rows: node.rows, children: []*planNode{node}}
+	}
+	if s.Limit != nil || s.Offset != nil {
+		limit, offset := -1, 0
+		if s.Limit != nil {
+			if limit, err = countValue("LIMIT", s.Limit); err != nil {
+				return nil, err
+			}
+		}
+		if s.Offset != nil {
+			if offset, err = countValue("OFFSET", s.Offset); err != nil {
+				return nil, err
+			}
+		}
+		node = limitNode(node, limit, offset)
+	}
+	return node, nil
+}
+
+// operator describes an operator of a query plan and those below it
+func (x *explainer) operator(ctx context.Context, q *query, op operator) (*planNode, error) {
+	if s, ok := op.(*scanOp); ok {
+		return x.scan(ctx, q, s.source, s.keys, s.limit)
+	}
+	child := input(op)
+	if child == nil {
+		return nil, fmt.Errorf("EXPLAIN does not support operator %T", op)
+	}
+	in, err := x.operator(ctx, q, *child)
+	if err != nil {
+		return nil, err
+	}
+	node := &planNode{op: q.describe(op), rows: in.rows, children: []*planNode{in}}
+
+	switch o := op.(type) {
+	case *lookupJoinOp:
+		if src := q.sources[o.source]; src.cte != nil {
+			mat, _, err := x.materialize(ctx, src.cte)
+			if err != nil {
+				return nil, err
+			}
+			if mat != nil {
+				node.children = append(node.children, mat)
+			}
+			break
+		}
+		node.cmds, node.trips = in.rows, batches(in.rows)
+	case *nestedLoopJoinOp:
+		inner, err := x.scan(ctx, q, o.source, q.sourceKeys(o.source, ""), 0)
+		if err != nil {
+			return nil, err
+		}
+		node.rows = in.rows * inner.rows
+		node.children = append(node.children, inner)
+	case *aggregateOp:
+		if len(q.groupBy) == 0 {
+			node.rows = 1
+		}
+	case *distinctOp:
+		if limit := int64(x.e.DistinctMemory); limit > 0 && in.rows > limit {
+			// past DistinctMemory rows, each batch of rows is checked with SADD
+			node.op += fmt.Sprintf(", in a KeyDB set after %d rows", limit)
+			node.cmds = in.rows + 2
+			node.trips = batches(in.rows-limit) + 2
+		}
+	case *limitOp:
+		return limitNode(in, o.limit, o.offset), nil
+	}
+	return node, nil
+}
+
+// input returns the field holding the operator op reads its rows from, nil
+// for a scan
+func input(op operator) *operator {
+	switch o := op.(type) {
+	case *lookupJoinOp:
+		return &o.child
+	case *nestedLoopJoinOp:
+		return &o.child
+	case *filterOp:
+		return &o.child
+	case *aggregateOp:
+		return &o.child
+	case *projectOp:
+		return &o.child
+	case *distinctOp:
+		return &o.child
+	case *sortOp:
+		return &o.child
+	case *limitOp:
+		return &o.child
+	}
+	return nil
+}
+
+// describe names an operator of q and what it does
+func (q *query) describe(op operator) string {
+	switch o := op.(type) {
+	case *scanOp:
+		return q.describeScan(o.source, o.keys)
+	case *lookupJoinOp:
+		src := q.sources[o.source]
+		s := fmt.Sprintf("Lookup join %s: %s = %s", src.ref, q.bindingName(o.inner), q.bindingName(o.outer))
+		if src.cte == nil {
+			s += ", HGETALL per row"
+		}
+		return s
+	case *nestedLoopJoinOp:
+		return fmt.Sprintf("Nested loop join %s: %s", q.sources[o.source].ref, o.on)
+	case *filterOp:
+		if o.cond == q.having {
+			return "Filter (HAVING): " + o.cond.String()
+		}
+		return "Filter: " + o.cond.String()
+	case *aggregateOp:
+		calls := make([]string, len(q.aggregates))
+		for i, call := range q.aggregates {
+			calls[i] = call.String()
+		}
+		s := "Aggregate: " + strings.Join(calls, ", ")
+		if len(q.groupBy) > 0 {
+			s += " GROUP BY " + exprList(q.groupBy)
+		}
+		return s
+	case *projectOp:
+		fields := make([]string, len(q.stmt.Fields))
+		for i, f := range q.stmt.Fields {
+			fields[i] = f.String()
+		}
+		return "Project: " + strings.Join(fields, ", ")
+	case *distinctOp:
+		return "Distinct"
+	case *sortOp:
+		return "Sort: " + orderItems(o.items)
+	case *limitOp:
+		return limitLabel(o.limit, o.offset)
+	}
+	return fmt.Sprintf("%T", op)
+}
+
+// describeScan names the way the rows of source i are found from keys
+func (q *query) describeScan(i int, keys keyIterator) string {
+	src := q.sources[i]
+	if src.cte == oneRow {
+		return "No table: a single row"
+	}
+	if src.cte != nil {
+		return fmt.Sprintf("Scan %s: CTE rows in memory", src.ref)
+	}
+	t := src.table
+	switch k := keys.(type) {
+	case *listKeys:
+		names := make([]string, len(k.ids))
+		for j, id := range k.ids {
+			names[j] = t.key(id)
+		}
+		return fmt.Sprintf("Key lookup %s: HGETALL %s", src.ref, strings.Join(names, " "))
+	case *rangeKeys:
+		s := fmt.Sprintf("Scan %s: HGETALL %s..%s", src.ref, t.key("1"), t.key(strconv.Itoa(k.count)))
+		if k.prefix != "" {
+			s += fmt.Sprintf(", ids starting with %s", k.prefix)
+		}
+		return s
+	case *scanKeys:
+		return fmt.Sprintf("Scan %s: SCAN MATCH %s, HGETALL per key", src.ref, k.match)
+	case *indexKeys:
+		cmd := "ZRANGEBYLEX"
+		switch {
+		case k.index.Kind == ScoreIndex && k.reverse:
+			cmd = "ZREVRANGEBYSCORE"
+		case k.index.Kind == ScoreIndex:
+			cmd = "ZRANGEBYSCORE"
+		}
+		s := fmt.Sprintf("Index range %s: %s %s %s %s, HGETALL per key", src.ref, cmd, k.index.Key, strconv.Quote(k.min), strconv.Quote(k.max))
+		if q.presorted && i == 0 {
+			s += ", in ORDER BY order"
+		}
+		return s
+	}
+	return fmt.Sprintf("Scan %s", src.ref)
+}
+
+// scan describes how the rows of source i are found, from the keys it reads
+func (x *explainer) scan(ctx context.Context, q *query, i int, keys keyIterator, limit int) (*planNode, error) {
+	node := &planNode{op: q.describeScan(i, keys)}
+	if src := q.sources[i]; src.cte == oneRow {
+		node.rows = 1
+		return node, nil
+	} else if src.cte != nil {
+		mat, rows, err := x.materialize(ctx, src.cte)
+		if err != nil {
+			return nil, err
+		}
+		node.rows = rows
+		if mat != nil {
+			node.children = []*planNode{mat}
+		}
+		return node, nil
+	}
+
+	switch k := keys.(type) {
+	case *listKeys:
+		node.rows = int64(len(k.ids))
+	case *rangeKeys:
+		for id := 1; id <= k.count; id++ {
+			if strings.HasPrefix(strconv.Itoa(id), k.prefix) {
+				node.rows++
+			}
+		}
+	case *scanKeys:
+		size, err := x.size(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if node.rows, err = x.tableRows(ctx, q.sources[i].table); err != nil {
+			return nil, err
+		}
+		// SCAN walks the whole keyspace, a batch at a time, and the keys of
+		// each batch are read with one pipeline
+		scans := batches(size)
+		if limit > 0 && int64(limit) < node.rows {
+			scans = batches(size * int64(limit) / node.rows)
+			node.rows = int64(limit)
+		}
+		node.cmds = scans + node.rows
+		node.trips = scans + min(scans, node.rows)
+		return node, nil
+	case *indexKeys:
+		var err error
+		if node.rows, err = x.indexRows(ctx, k); err != nil {
+			return nil, err
+		}
+		node.cmds, node.trips = 1, 1
+	default:
+		return nil, fmt.Errorf("EXPLAIN does not support key iterator %T", keys)
+	}
+	if limit > 0 && int64(limit) < node.rows {
+		node.rows = int64(limit)
+	}
+	node.cmds += node.rows
+	node.trips += batches(node.rows)
+	return node, nil
+}
+
+// materialize plans the queries of a CTE the first time it is read, and
+// returns its estimated rows. A CTE read again, or by its own recursive
+// member, has no plan: it is materialized once.
+func (x *explainer) materialize(ctx context.Context, c *cte) (*planNode, int64, error) {
+	if rows, ok := x.ctes[c]; ok {
+		return nil, rows, nil
+	}
+	x.ctes[c] = 0
+	anchor, err := x.query(ctx, c.def.Select, c.scope)
+	if err != nil {
+		return nil, 0, err
+	}
+	x.ctes[c] = anchor.rows
+	node := &planNode{op: "Materialize CTE " + c.def.Name, rows: anchor.rows, children: []*planNode{anchor}}
+	if c.def.Union != nil {
+		member, err := x.query(ctx, c.def.Union, c.scope)
+		if err != nil {
+			return nil, 0, err
+		}
+		if c.recursive && refersTo(c.def.Union, c.def.Name) {
+			node.op = fmt.Sprintf("Materialize recursive CTE %s, the second query running once per step", c.def.Name)
+		}
+		node.rows += member.rows
+		node.children = append(node.children, member)
+	}
+	x.ctes[c] = node.rows
+	return node, node.rows, nil
+}
+
+// subqueries plans the subqueries of a query. Uncorrelated ones run once,
+// correlated ones once for each distinct set of outer values, so at most
+// once per row of the query.
+func (x *explainer) subqueries(ctx context.Context, q *query, sc *scope, rows int64) ([]*planNode, error) {
+	names := refNames(q.stmt)
+	exists := make(map[*parser.SubqueryExpr]bool)
+	var nodes []*planNode
+	var err error
+	for _, expr := range stmtExprs(q.stmt) {
+		parser.Walk(expr, func(e parser.Expr) bool {
+			if err != nil {
+				return false
+			}
+			switch e := e.(type) {
+			case *parser.ExistsExpr:
+				exists[e.Subquery] = true
+			case *parser.SubqueryExpr:
+				sel := e.Select
+				if exists[e] && sel.Limit == nil {
+					first := *sel
+					first.Limit = &parser.Literal{Value: int64(1)}
+					sel = &first
+				}
+				node := &planNode{op: "Subquery, run once"}
+				if refs := outerRefs(sel, names); len(refs) > 0 {
+					// plan it for a row, as it runs
+					row := make(Row)
+					for _, col := range refs {
+						row[col.String()] = "?"
+					}
+					sel = bindOuter(sel, row, names)
+					node.op = fmt.Sprintf("Correlated subquery, run up to %d times", rows)
+					node.runs = rows
+				}
+				var plan *planNode
+				if plan, err = x.query(ctx, sel, sc); err != nil {
+					return false
+				}
+				node.rows = plan.rows
+				node.children = []*planNode{plan}
+				nodes = append(nodes, node)
+			}
+			return true
+		})
+	}
+	return nodes, err
+}
+
+// size returns the number of keys in the database
+func (x *explainer) size(ctx context.Context) (int64, error) {
+	if x.dbsize < 0 {
+		n, err := x.e.rdb.DBSize(ctx).Result()
+		if err != nil {
+			return 0, backendError(err)
+		}
+		x.dbsize = n
+	}
+	return x.dbsize, nil
+}
+
+// tableRows estimates the rows of a table: its Count, or the size of its
+// largest index, or at worst the number of keys in the database
+func (x *explainer) tableRows(ctx context.Context, t *Table) (int64, error) {
+	if t.Count > 0 {
+		return int64(t.Count), nil
+	}
+	if n, ok := x.sizes[t.Pattern]; ok {
+		return n, nil
+	}
+	var rows int64
+	for _, idx := range t.Indexes {
+		n, err := x.e.rdb.ZCard(ctx, idx.Key).Result()
+		if err != nil {
+			return 0, backendError(err)
+		}
+		rows = max(rows, n)
+	}
+	if rows == 0 {
+		var err error
+		if rows, err = x.size(ctx); err != nil {
+			return 0, err
+		}
+	}
+	x.sizes[t.Pattern] = rows
+	return rows, nil
+}
+
+// indexRows counts the members of an index range
+func (x *explainer) indexRows(ctx context.Context, k *indexKeys) (int64, error) {
+	var n int64
+	var err error
+	if k.index.Kind == LexIndex {
+		n, err = x.e.rdb.ZLexCount(ctx, k.index.Key, k.min, k.max).Result()
+	} else {
+		n, err = x.e.rdb.ZCount(ctx, k.index.Key, k.min, k.max).Result()
+	}
+	return n, backendError(err)
+}
+
+// bindingName renders the column a binding reads, such as u.id
+func (q *query) bindingName(b *binding) string {
+	name := b.field
+	if b.pseudo != "" {
+		name = b.pseudo
+	}
+	if b.source >= 0 {
+		name = q.sources[b.source].ref.RefName() + "." + name
+	}
+	for _, step := range b.path {
+		name += "." + step
+	}
+	return name
+}
+
+func limitNode(in *planNode, limit, offset int) *planNode {
+	node := &planNode{op: limitLabel(limit, offset), rows: in.rows, children: []*planNode{in}}
+	if limit >= 0 {
+		node.rows = min(in.rows, int64(offset+limit))
+	}
+	if offset > 0 {
+		node.rows = max(node.rows-int64(offset), 0)
+	}
+	return node
+}
+
+func limitLabel(limit, offset int) string {
+	s := fmt.Sprintf("Limit: %d", limit)
+	if limit < 0 {
+		s = "Limit: all"
+	}
+	if offset > 0 {
+		s += fmt.Sprintf(" offset %d", offset)
+	}
+	return s
+}
+
+func orderItems(items []*parser.OrderItem) string {
+	s := make([]string, len(items))
+	for i, item := range items {
+		s[i] = item.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+func exprList(exprs []parser.Expr) string {
+	s := make([]string, len(exprs))
+	for i, expr := range exprs {
+		s[i] = expr.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// maxRows returns the largest row estimate of the operators of a plan
+func maxRows(n *planNode) int64 {
+	rows := n.rows
+	for _, child := range n.children {
+		rows = max(rows, maxRows(child))
+	}
+	return rows
+}
+
+// batches returns the number of pipelined round trips reading n keys
+func batches(n int64) int64 {
+	return (n + batchSize - 1) / batchSize
+}
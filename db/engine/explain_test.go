@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"EXPLAIN SELECT name FROM users WHERE id = '2'", []string{
+			"-> Project: name | 1 | 0 | 0",
+			"    -> Filter: (id = '2') | 1 | 0 | 0",
+			"        -> Key lookup users: HGETALL user:2 | 1 | 1 | 1",
+			"total | NULL | 1 | 1",
+		}},
+		{"EXPLAIN SELECT name FROM users WHERE name LIKE 'A%'", []string{
+			"-> Project: name | 1 | 0 | 0",
+			"    -> Filter: (name LIKE 'A%') | 1 | 0 | 0",
+			`        -> Index range users: ZRANGEBYLEX idx:user:name "[A" "(A\xff", HGETALL per key | 1 | 2 | 2`,
+			"total | NULL | 2 | 2",
+		}},
+		{"EXPLAIN SELECT name FROM users WHERE age > 30 ORDER BY age", []string{
+			"-> Project: name | 2 | 0 | 0",
+			"    -> Filter: (age > 30) | 2 | 0 | 0",
+			`        -> Index range users: ZRANGEBYSCORE idx:user:age "(30" "+inf", HGETALL per key, in ORDER BY order | 2 | 3 | 2`,
+			"total | NULL | 3 | 2",
+		}},
+		// the limit stops the scan
+		{"EXPLAIN SELECT name FROM users LIMIT 2", []string{
+			"-> Project: name | 2 | 0 | 0",
+			"    -> Limit: 2 | 2 | 0 | 0",
+			"        -> Scan users: SCAN MATCH user:*, HGETALL per key | 2 | 3 | 2",
+			"total | NULL | 3 | 2",
+		}},
+		{"EXPLAIN SELECT u.name, p.city FROM users u JOIN profiles p ON p.id = u.id WHERE u.country = 'USA'", []string{
+			"-> Project: u.name, p.city | 5 | 0 | 0",
+			"    -> Filter: (u.country = 'USA') | 5 | 0 | 0",
+			"        -> Lookup join profiles AS p: p.id = u.id, HGETALL per row | 5 | 5 | 1",
+			"            -> Scan users AS u: SCAN MATCH user:*, HGETALL per key | 5 | 6 | 2",
+			"total | NULL | 11 | 3",
+		}},
+		{"EXPLAIN SELECT country, COUNT(*) FROM users GROUP BY country HAVING COUNT(*) > 1", []string{
+			"-> Project: country, COUNT(*) | 5 | 0 | 0",
+			"    -> Filter (HAVING): (COUNT(*) > 1) | 5 | 0 | 0",
+			"        -> Aggregate: COUNT(*) GROUP BY country | 5 | 0 | 0",
+			"            -> Scan users: SCAN MATCH user:*, HGETALL per key | 5 | 6 | 2",
+			"total | NULL | 6 | 2",
+		}},
+		{"EXPLAIN SELECT 1 + 1", []string{
+			"-> Project: (1 + 1) | 1 | 0 | 0",
+			"    -> No table: a single row | 1 | 0 | 0",
+			"total | NULL | 0 | 0",
+		}},
+	})
+}
+
+func TestExplainCompound(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"EXPLAIN WITH c AS (SELECT country FROM users GROUP BY country) SELECT * FROM c", []string{
+			"-> Project: * | 5 | 0 | 0",
+			"    -> Scan c: CTE rows in memory | 5 | 0 | 0",
+			"        -> Materialize CTE c | 5 | 0 | 0",
+			"            -> Project: country | 5 | 0 | 0",
+			"                -> Aggregate:  GROUP BY country | 5 | 0 | 0",
+			"                    -> Scan users: SCAN MATCH user:*, HGETALL per key | 5 | 6 | 2",
+			"total | NULL | 6 | 2",
+		}},
+		{"EXPLAIN SELECT name FROM users WHERE id = '1' UNION ALL SELECT name FROM users WHERE id = '2' LIMIT 1", []string{
+			"-> Limit: 1 | 1 | 0 | 0",
+			"    -> UNION ALL | 2 | 0 | 0",
+			"        -> Project: name | 1 | 0 | 0",
+			"            -> Filter: (id = '1') | 1 | 0 | 0",
+			"                -> Key lookup users: HGETALL user:1 | 1 | 1 | 1",
+			"        -> Project: name | 1 | 0 | 0",
+			"            -> Filter: (id = '2') | 1 | 0 | 0",
+			"                -> Key lookup users: HGETALL user:2 | 1 | 1 | 1",
+			"total | NULL | 2 | 2",
+		}},
+	})
+}
+
+func TestExplainDoesNotRun(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	res, err := eng.Query(context.Background(), "EXPLAIN SELECT name FROM users WHERE country = ?", "UK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"plan", "rows", "commands", "round trips"}; !reflect.DeepEqual(res.Columns, want) {
+		t.Errorf("columns = %q, want %q", res.Columns, want)
+	}
+	if last := res.Rows[len(res.Rows)-1]; last[0] != "total" || last[2] != int64(6) {
+		t.Errorf("total row = %v, want 6 commands", last)
+	}
+
+	// only sizes are asked for, those of the two indexes of users and of
+	// the keyspace: no hash is read
+	before := mr.CommandCount()
+	if _, err := eng.Query(context.Background(), "EXPLAIN SELECT name FROM users u JOIN profiles p ON p.id = u.id"); err != nil {
+		t.Fatal(err)
+	}
+	if n := mr.CommandCount() - before; n != 3 {
+		t.Errorf("EXPLAIN issued %d commands, want 3", n)
+	}
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"db-parse/parser"
+)
+
+// Function computes the result of a scalar function from its evaluated
+// arguments, where nil is NULL. Arguments read from hashes are strings.
+type Function func(args []interface{}) (interface{}, error)
+
+var (
+	functionsMu sync.RWMutex
+	// functions holds the scalar functions, by upper-cased name
+	functions = map[string]Function{
+		"COALESCE":         coalesce,
+		"IFNULL":           ifNull,
+		"UPPER":            upper,
+		"UCASE":            upper,
+		"LOWER":            lower,
+		"LCASE":            lower,
+		"LENGTH":           length,
+		"CHAR_LENGTH":      charLength,
+		"CHARACTER_LENGTH": charLength,
+		"SUBSTRING":        substring,
+		"SUBSTR":           substring,
+		"LEFT":             edge("LEFT", false),
+		"RIGHT":            edge("RIGHT", true),
+		"CONCAT":           concat,
+		"CONCAT_WS":        concatWS,
+		"TRIM":             trim("TRIM", strings.TrimSpace),
+		"LTRIM":            trim("LTRIM", func(s string) string { return strings.TrimLeft(s, " \t\r\n") }),
+		"RTRIM":            trim("RTRIM", func(s string) string { return strings.TrimRight(s, " \t\r\n") }),
+		"REPLACE":          replace,
+		"ROUND":            round,
+		"ABS":              abs,
+		"CEIL":             ceil,
+		"CEILING":          ceil,
+		"FLOOR":            floor,
+		"NOW":              now,
+		"DATABASE":         currentDatabase,
+		"SCHEMA":           currentDatabase,
+		"DATE_FORMAT":      dateFormat,
+		"JSON_EXTRACT":     jsonExtract,
+	}
+)
+
+// RegisterFunction makes fn callable from queries under name, which is
+// case-insensitive, replacing any scalar function with that name:
+//
+//	engine.RegisterFunction("MASK_EMAIL", func(args []interface{}) (interface{}, error) { ... })
+//
+// Aggregate functions can't be replaced.
+func RegisterFunction(name string, fn Function) error {
+	name = strings.ToUpper(name)
+	if _, ok := aggregates[name]; ok {
+		return fmt.Errorf("%s is an aggregate function", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("function %s is nil", name)
+	}
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+	functions[name] = fn
+	return nil
+}
+
+func lookupFunction(name string) (Function, bool) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// checkFunctions rejects calls of unknown functions before a query runs
+func checkFunctions(exprs []parser.Expr) error {
+	var err error
+	for _, expr := range exprs {
+		parser.Walk(expr, func(e parser.Expr) bool {
+			call, ok := e.(*parser.FuncCall)
+			if !ok || err != nil || isAggregate(call) {
+				return err == nil
+			}
+			if _, ok := lookupFunction(call.Name); !ok {
+				err = &UnknownFunctionError{Name: call.Name}
+			} else if call.Distinct {
+				err = fmt.Errorf("DISTINCT is not allowed in %s", call.Name)
+			}
+			return err == nil
+		})
+	}
+	return err
+}
+
+// evalCall calls a scalar function. An aggregate call isn't computed here:
+// its value is part of the row produced for each group.
+func (d Dialect) evalCall(e *parser.FuncCall, row Row) (interface{}, error) {
+	if isAggregate(e) {
+		if v, ok := row[e.String()]; ok {
+			return v, nil
+		}
+		return nil, &AggregateUseError{Func: e.Name}
+	}
+	fn, ok := lookupFunction(e.Name)
+	if !ok {
+		return nil, &UnknownFunctionError{Name: e.Name}
+	}
+	args := make([]interface{}, len(e.Args))
+	for i, arg := range e.Args {
+		v, err := d.eval(arg, row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return fn(args)
+}
+
+// coalesce returns its first non-NULL argument
+func coalesce(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("COALESCE expects at least one argument")
+	}
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+// ifNull returns its second argument when the first is NULL
+func ifNull(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("IFNULL expects 2 arguments, got %d", len(args))
+	}
+	return coalesce(args)
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScalarFunctions(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "nick", "  ann  ", "score", "-2.456", "joined", "2024-05-01 08:05:09",
+		"address", `{"city":"Pune","tags":["a","b"],"geo":{"lat":18.5}}`)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT UPPER(name), LOWER(name), UCASE(country), LCASE(country) FROM users WHERE id = '1'", []string{"ANN | ann | INDIA | india"}},
+		{"SELECT LENGTH(email), CHAR_LENGTH('héllo'), LENGTH('héllo') FROM users WHERE id = '1'", []string{"15 | 5 | 6"}},
+		{"SELECT SUBSTRING(email, 1, 3), SUBSTR(email, 5), SUBSTRING(email, -3) FROM users WHERE id = '1'", []string{"ann | example.com | com"}},
+		{"SELECT LEFT(name, 2), RIGHT(name, 2), LEFT('héllo', 2), RIGHT(email, 3), LEFT(name, 0), RIGHT(name, 10), LEFT(manager_id, 1) FROM users WHERE id = '1'", []string{
+			"An | nn | hé | com |  | Ann | NULL",
+		}},
+		{"SELECT CONCAT(name, '-', age), CONCAT(name, manager_id), CONCAT_WS('/', name, manager_id, country) FROM users WHERE id = '1'", []string{"Ann-30 | NULL | Ann/India"}},
+		{"SELECT TRIM(nick), LTRIM(nick) || '|', '|' || RTRIM(nick), REPLACE(email, 'example', 'test') FROM users WHERE id = '1'", []string{"ann | ann  | | |  ann | ann@test.com"}},
+		{"SELECT ROUND(score), ROUND(score, 2), ROUND(1234, -2), ABS(score), ABS(-3) FROM users WHERE id = '1'", []string{"-2 | -2.46 | 1200 | 2.456 | 3"}},
+		{"SELECT CEIL(score), CEILING(2.1), FLOOR(score) FROM users WHERE id = '1'", []string{"-2 | 3 | -3"}},
+		{"SELECT DATE_FORMAT(joined, '%Y-%m-%d %H:%i:%s'), DATE_FORMAT(joined, '%D %M %Y, %W %l%p'), DATE_FORMAT(name, '%Y') FROM users WHERE id = '1'", []string{
+			"2024-05-01 08:05:09 | 1st May 2024, Wednesday 8AM | NULL",
+		}},
+		{`SELECT JSON_EXTRACT(address, '$.city'), JSON_EXTRACT(address, '$.tags[1]'), JSON_EXTRACT(address, '$.geo'), JSON_EXTRACT(address, '$.zip') FROM users WHERE id = '1'`, []string{
+			`Pune | b | {"lat":18.5} | NULL`,
+		}},
+		// functions work in WHERE too, and take NULL to NULL
+		{"SELECT name FROM users WHERE UPPER(country) = 'USA' ORDER BY name", []string{"Bob", "Eve"}},
+		{"SELECT name FROM users WHERE LENGTH(name) = 3 AND SUBSTRING(name, 1, 1) IN ('A', 'E') ORDER BY name", []string{"Ann", "Eve"}},
+		{"SELECT UPPER(manager_id), ROUND(age) FROM users WHERE id = '1'", []string{"NULL | 30"}},
+	})
+}
+
+func TestNow(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	before := time.Now().Truncate(time.Second)
+	res, err := eng.Query(context.Background(), "SELECT NOW() FROM users WHERE id = '1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := res.Rows[0][0].(time.Time)
+	if !ok {
+		t.Fatalf("NOW() = %#v, want a time", res.Rows[0][0])
+	}
+	wall := time.Date(before.Year(), before.Month(), before.Day(), before.Hour(), before.Minute(), before.Second(), 0, time.UTC)
+	if got.Before(wall) || got.Sub(wall) > time.Minute {
+		t.Errorf("NOW() = %v, want about %v", got, wall)
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	tests := []struct {
+		query string
+		msg   string
+	}{
+		{"SELECT NO_SUCH_FN(name) FROM users", "unknown function NO_SUCH_FN"},
+		{"SELECT UPPER(name, age) FROM users", "UPPER"},
+		{"SELECT ROUND(name) FROM users WHERE id = '1'", "ROUND"},
+		{"SELECT LEFT(name) FROM users WHERE id = '1'", "LEFT expects 2 arguments"},
+		{"SELECT RIGHT(name, 'x') FROM users WHERE id = '1'", "RIGHT"},
+		{"SELECT UPPER(DISTINCT name) FROM users", "DISTINCT is not allowed in UPPER"},
+		{"SELECT JSON_EXTRACT(name, 'city') FROM users WHERE id = '1'", "invalid JSON path"},
+	}
+	for _, tt := range tests {
+		_, err := eng.Query(context.Background(), tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%s: error = %v, want it to mention %q", tt.query, err, tt.msg)
+		}
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	err := RegisterFunction("mask_email", func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		s := toString(args[0])
+		at := strings.IndexByte(s, '@')
+		if at < 1 {
+			return s, nil
+		}
+		return s[:1] + strings.Repeat("*", at-1) + s[at:], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		functionsMu.Lock()
+		delete(functions, "MASK_EMAIL")
+		functionsMu.Unlock()
+	})
+	checkQueries(t, eng, []queryTest{
+		{"SELECT Mask_Email(email) FROM users WHERE id = '2'", []string{"b**@example.com"}},
+		{"SELECT name FROM users WHERE MASK_EMAIL(email) = 'd**@example.com'", []string{"Dee"}},
+	})
+
+	if err := RegisterFunction("count", func([]interface{}) (interface{}, error) { return nil, nil }); err == nil {
+		t.Error("RegisterFunction(count) succeeded, want an error for an aggregate")
+	}
+	if err := RegisterFunction("nothing", nil); err == nil {
+		t.Error("RegisterFunction(nothing, nil) succeeded, want an error")
+	}
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"db-parse/parser"
+)
+
+// defaultEscape is the LIKE escape character when no ESCAPE clause is given
+const defaultEscape = '\\'
+
+// maxPatterns bounds the number of compiled patterns kept, the least
+// recently used being dropped first
+const maxPatterns = 1000
+
+// patterns caches compiled LIKE and REGEXP patterns, keyed by operator,
+// escape character and pattern
+var patterns = &patternCache{order: list.New(), entries: make(map[string]*list.Element)}
+
+// patternCache is a cache of compiled patterns holding at most maxPatterns,
+// most recently used first in order
+type patternCache struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedPattern struct {
+	key string
+	re  *regexp.Regexp
+}
+
+func (c *patternCache) get(key string) (*regexp.Regexp, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedPattern).re, true
+}
+
+func (c *patternCache) add(key string, re *regexp.Regexp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cachedPattern{key: key, re: re})
+	if c.order.Len() > maxPatterns {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedPattern).key)
+	}
+}
+
+// evalLike matches a value against a LIKE, ILIKE or REGEXP pattern. In the
+// MySQL dialect LIKE ignores case, like ILIKE.
+func (d Dialect) evalLike(e *parser.LikeExpr, row Row) (interface{}, error) {
+	v, err := d.eval(e.Expr, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	p, err := d.eval(e.Pattern, row)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	escape := defaultEscape
+	if e.Escape != nil {
+		ev, err := d.eval(e.Escape, row)
+		if err != nil {
+			return nil, err
+		}
+		es := []rune(toString(ev))
+		if len(es) != 1 {
+			return nil, fmt.Errorf("ESCAPE must be a single character, got %q", string(es))
+		}
+		escape = es[0]
+	}
+
+	op := e.Op
+	if op == "LIKE" && d == MySQL {
+		op = "ILIKE"
+	}
+	re, err := compilePattern(op, toString(p), escape)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(toString(v)) != e.Not, nil
+}
+
+// compilePattern turns a LIKE/ILIKE pattern into an anchored regular
+// expression, or compiles a REGEXP pattern. REGEXP is case-insensitive, as
+// with MySQL's default collations.
+func compilePattern(op, pattern string, escape rune) (*regexp.Regexp, error) {
+	cacheKey := op + "\x00" + string(escape) + "\x00" + pattern
+	if re, ok := patterns.get(cacheKey); ok {
+		return re, nil
+	}
+
+	var expr string
+	switch op {
+	case "LIKE":
+		expr = likeToRegexp(pattern, escape)
+	case "ILIKE":
+		expr = "(?i)" + likeToRegexp(pattern, escape)
+	case "REGEXP":
+		expr = "(?i)" + pattern
+	default:
+		return nil, &UnsupportedError{What: "operator " + op}
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q: %v", op, pattern, err)
+	}
+	patterns.add(cacheKey, re)
+	return re, nil
+}
+
+func likeToRegexp(pattern string, escape rune) string {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == escape:
+			escaped = true
+		case r == '%':
+			sb.WriteString(".*")
+		case r == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		// A trailing escape character matches itself
+		sb.WriteString(regexp.QuoteMeta(string(escape)))
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// likePrefix returns the fixed text a LIKE pattern starts with, before its
+// first wildcard, and whether the pattern is nothing but that prefix
+func likePrefix(pattern string, escape rune) (prefix string, exact bool) {
+	var sb strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case r == escape:
+			escaped = true
+		case r == '%' || r == '_':
+			return sb.String(), false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if escaped {
+		sb.WriteRune(escape)
+	}
+	return sb.String(), true
+}
+
+// globEscape escapes the characters that are special in a SCAN MATCH pattern
+func globEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
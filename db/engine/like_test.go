@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLike(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		// name has a lex index, answered with ZRANGEBYLEX
+		{"SELECT name FROM users WHERE name LIKE 'C%'", []string{"Cid"}},
+		{"SELECT name FROM users WHERE name LIKE 'c%'", nil},
+		{"SELECT name FROM users WHERE name ILIKE 'c%'", []string{"Cid"}},
+		{"SELECT name FROM users WHERE name LIKE '_e_' ORDER BY name", []string{"Dee"}},
+		{"SELECT name FROM users WHERE name NOT LIKE '%e%' ORDER BY name", []string{"Ann", "Bob", "Cid"}},
+		{"SELECT name FROM users WHERE email LIKE '%@example.com' AND country = 'UK'", []string{"Dee"}},
+		{"SELECT name FROM users WHERE name REGEXP '^[ab]' ORDER BY name", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users WHERE name NOT RLIKE 'e$' ORDER BY name", []string{"Ann", "Bob", "Cid"}},
+		// a fixed prefix on id or key narrows the key scan
+		{"SELECT name FROM users WHERE id LIKE '3%'", []string{"Cid"}},
+		{"SELECT name FROM users WHERE key LIKE 'user:4'", []string{"Dee"}},
+		{"SELECT name FROM users WHERE key LIKE 'other:%'", nil},
+	})
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		escape  rune
+		matches []string
+		misses  []string
+	}{
+		{"a%", '\\', []string{"a", "abc"}, []string{"ba", "A"}},
+		{"a_c", '\\', []string{"abc", "a.c"}, []string{"ac", "abbc"}},
+		{`100\%`, '\\', []string{"100%"}, []string{"1000"}},
+		{"a!_b", '!', []string{"a_b"}, []string{"axb"}},
+		{"a.*", '\\', []string{"a.*"}, []string{"abc"}},
+	}
+	for _, tt := range tests {
+		re, err := compilePattern("LIKE", tt.pattern, tt.escape)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.matches {
+			if !re.MatchString(s) {
+				t.Errorf("%q LIKE %q = false, want true", s, tt.pattern)
+			}
+		}
+		for _, s := range tt.misses {
+			if re.MatchString(s) {
+				t.Errorf("%q LIKE %q = true, want false", s, tt.pattern)
+			}
+		}
+	}
+}
+
+// TestPatternCache checks that compiled patterns are reused and that the
+// cache drops the least recently used past maxPatterns
+func TestPatternCache(t *testing.T) {
+	first, err := compilePattern("LIKE", "cached%", defaultEscape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxPatterns+10; i++ {
+		if _, err := compilePattern("LIKE", fmt.Sprintf("p%d%%", i), defaultEscape); err != nil {
+			t.Fatal(err)
+		}
+		if i%100 == 0 {
+			// in use, so kept
+			if again, _ := compilePattern("LIKE", "cached%", defaultEscape); again != first {
+				t.Fatalf("cached%% was compiled again after %d patterns", i)
+			}
+		}
+	}
+	patterns.mu.Lock()
+	size := patterns.order.Len()
+	_, oldest := patterns.entries["LIKE\x00\\\x00p0%"]
+	_, newest := patterns.entries[fmt.Sprintf("LIKE\x00\\\x00p%d%%", maxPatterns+9)]
+	patterns.mu.Unlock()
+	if size != maxPatterns {
+		t.Errorf("cache holds %d patterns, want %d", size, maxPatterns)
+	}
+	if oldest || !newest {
+		t.Errorf("cache kept the least recently used pattern (%v) or dropped the newest (%v)", oldest, !newest)
+	}
+	if again, _ := compilePattern("LIKE", "cached%", defaultEscape); again != first {
+		t.Error("cached% was compiled again")
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	tests := []struct {
+		pattern, prefix string
+		exact           bool
+	}{
+		{"abc%", "abc", false},
+		{"ab_d", "ab", false},
+		{"abc", "abc", true},
+		{`a\%b%`, "a%b", false},
+		{"%abc", "", false},
+	}
+	for _, tt := range tests {
+		prefix, exact := likePrefix(tt.pattern, '\\')
+		if prefix != tt.prefix || exact != tt.exact {
+			t.Errorf("likePrefix(%q) = %q, %v, want %q, %v", tt.pattern, prefix, exact, tt.prefix, tt.exact)
+		}
+	}
+}
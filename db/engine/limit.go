@@ -0,0 +1,27 @@
+package engine
+
+import "context"
+
+// limitOp skips the first offset rows and stops after limit more. Once the
+// limit is reached it no longer pulls from its child, so the scan below it
+// stops issuing KeyDB commands.
+type limitOp struct {
+	child  operator
+	limit  int
+	offset int
+	seen   int
+}
+
+func (l *limitOp) next(ctx context.Context) (*record, error) {
+	for l.seen < l.offset+l.limit {
+		rec, err := l.child.next(ctx)
+		if err != nil || rec == nil {
+			return nil, err
+		}
+		l.seen++
+		if l.seen > l.offset {
+			return rec, nil
+		}
+	}
+	return nil, nil
+}
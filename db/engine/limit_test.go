@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users ORDER BY name LIMIT 2", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users ORDER BY name LIMIT 2 OFFSET 3", []string{"Dee", "Eve"}},
+		{"SELECT name FROM users ORDER BY name LIMIT 3, 1", []string{"Dee"}},
+		{"SELECT name FROM users ORDER BY name LIMIT 10 OFFSET 4", []string{"Eve"}},
+		{"SELECT name FROM users ORDER BY name LIMIT 0", nil},
+		{"SELECT name FROM users WHERE age > 20 ORDER BY age DESC LIMIT 1", []string{"Cid"}},
+	})
+	if got := queryRows(t, eng, "SELECT name FROM users LIMIT 3"); len(got) != 3 {
+		t.Errorf("SELECT name FROM users LIMIT 3 returned %q, want 3 rows", got)
+	}
+
+	// LIMIT 0 returns no row but still names the columns
+	for _, tt := range []struct {
+		query   string
+		columns string
+	}{
+		{"SELECT name FROM users LIMIT 0", "[name]"},
+		{"SELECT name FROM users ORDER BY name LIMIT 0", "[name]"},
+		{"SELECT DISTINCT country FROM users LIMIT 0", "[country]"},
+		{"SELECT country, COUNT(*) AS n FROM users GROUP BY country ORDER BY n LIMIT 0", "[country n]"},
+		{"SELECT * FROM profiles ORDER BY id LIMIT 0", "[bio city country]"},
+	} {
+		res, err := eng.Query(context.Background(), tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := fmt.Sprint(res.Columns); got != tt.columns || len(res.Rows) != 0 {
+			t.Errorf("%s: columns %s and %d rows, want %s and none", tt.query, got, len(res.Rows), tt.columns)
+		}
+	}
+}
+
+// TestLimitStopsScan checks that a LIMIT without WHERE or ORDER BY reads
+// only the hashes it returns
+func TestLimitStopsScan(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	for i := 100; i < 600; i++ {
+		mr.HSet(fmt.Sprintf("user:%d", i), "name", fmt.Sprintf("User %d", i))
+	}
+	before := mr.CommandCount()
+	res, err := eng.Query(context.Background(), "SELECT name FROM users LIMIT 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 10 {
+		t.Errorf("got %d rows, want 10", len(res.Rows))
+	}
+	// a few SCAN calls, then one HGETALL per row returned
+	if n := mr.CommandCount() - before; n > 30 {
+		t.Errorf("LIMIT 10 issued %d commands, want it to stop the scan early", n)
+	}
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"time"
+
+	"db-parse/parser"
+)
+
+// maxPrepared bounds the number of parsed statements an engine keeps. The
+// cache is emptied when it is full.
+const maxPrepared = 1000
+
+// Stmt is a prepared statement: a query parsed once, then run any number of
+// times with values bound to its ? or $n placeholders. The values are never
+// parsed as SQL, so they can't change the meaning of the query. A Stmt can be
+// used from several goroutines.
+type Stmt struct {
+	e      *Engine
+	query  string
+	stmt   parser.Statement
+	params int
+}
+
+// preparedKey identifies a parsed statement: the same text can parse
+// differently in each dialect
+type preparedKey struct {
+	dialect Dialect
+	query   string
+}
+
+// Prepare parses a query for later runs with Execute. Statements are cached
+// by their text, so preparing the same query again doesn't parse it again.
+func (e *Engine) Prepare(query string) (*Stmt, error) {
+	key := preparedKey{e.Dialect, query}
+	e.preparedMu.Lock()
+	s, ok := e.prepared[key]
+	e.preparedMu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	stmt, err := key.dialect.syntax().Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	s = e.newStmt(query, stmt)
+
+	e.preparedMu.Lock()
+	if len(e.prepared) >= maxPrepared {
+		e.prepared = make(map[preparedKey]*Stmt)
+	}
+	e.prepared[key] = s
+	e.preparedMu.Unlock()
+	return s, nil
+}
+
+// newStmt returns the statement prepared from the parsed query, counting
+// its placeholders
+func (e *Engine) newStmt(query string, stmt parser.Statement) *Stmt {
+	s := &Stmt{e: e, query: query, stmt: stmt}
+	rewriteParams(stmt, func(p *parser.Param) parser.Expr {
+		if p.Index > s.params {
+			s.params = p.Index
+		}
+		return nil
+	})
+	return s
+}
+
+// NumParams returns the number of values Execute expects: the number of ?
+// placeholders, or the highest n of the $n placeholders
+func (s *Stmt) NumParams() int {
+	return s.params
+}
+
+// String returns the query the statement was prepared from
+func (s *Stmt) String() string {
+	return s.query
+}
+
+// Execute runs the statement with args bound to its placeholders, in order
+// for ?, args[n-1] for $n. Arguments can be nil for NULL, strings, byte
+// slices, booleans, integers, floats, time.Time or a driver.Valuer returning
+// one of those.
+func (s *Stmt) Execute(ctx context.Context, args ...interface{}) (*Result, error) {
+	if len(args) != s.params {
+		return nil, fmt.Errorf("statement expects %d argument%s, got %d", s.params, plural(s.params), len(args))
+	}
+	stmt := s.stmt
+	if s.params > 0 {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			v, err := paramValue(arg)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %v", i+1, err)
+			}
+			values[i] = v
+		}
+		stmt = rewriteParams(stmt, func(p *parser.Param) parser.Expr {
+			return &parser.Literal{Value: values[p.Index-1]}
+		})
+	}
+	return s.e.exec(ctx, stmt, nil)
+}
+
+// paramValue converts a Go value bound to a placeholder to a query value
+func paramValue(arg interface{}) (interface{}, error) {
+	switch v := arg.(type) {
+	case nil, string, bool, int64, float64, time.Time:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint:
+		return uintValue(uint64(v))
+	case uint64:
+		return uintValue(v)
+	case float32:
+		return float64(v), nil
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return nil, err
+		}
+		if _, again := value.(driver.Valuer); again {
+			return nil, fmt.Errorf("unsupported type %T", value)
+		}
+		return paramValue(value)
+	}
+	return nil, fmt.Errorf("unsupported type %T", arg)
+}
+
+func uintValue(v uint64) (interface{}, error) {
+	if v > math.MaxInt64 {
+		return nil, fmt.Errorf("integer %d is too large", v)
+	}
+	return int64(v), nil
+}
+
+// rewriteParams returns a copy of stmt with the placeholders replaced by the
+// result of fn, including those of its subqueries, CTEs and LIMIT clauses,
+// and those of SET values and SHOW ... LIKE patterns.
+// A nil result leaves the placeholder in place.
+func rewriteParams(stmt parser.Statement, fn func(*parser.Param) parser.Expr) parser.Statement {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		return rewriteSelectParams(s, fn)
+	case *parser.ExplainStmt:
+		return &parser.ExplainStmt{Stmt: rewriteParams(s.Stmt, fn), Analyze: s.Analyze}
+	case *parser.SetOpStmt:
+		out := *s
+		out.With = rewriteWithParams(s.With, fn)
+		out.Left = rewriteParams(s.Left, fn)
+		out.Right = rewriteParams(s.Right, fn)
+		out.OrderBy = make([]*parser.OrderItem, len(s.OrderBy))
+		for i, item := range s.OrderBy {
+			out.OrderBy[i] = &parser.OrderItem{Expr: exprParams(item.Expr, fn), Desc: item.Desc, Nulls: item.Nulls}
+		}
+		out.Limit = exprParams(s.Limit, fn)
+		out.Offset = exprParams(s.Offset, fn)
+		return &out
+	case *parser.ShowStmt:
+		out := *s
+		out.Like = exprParams(s.Like, fn)
+		return &out
+	case *parser.SetStmt:
+		out := *s
+		out.Vars = make([]*parser.SetVar, len(s.Vars))
+		for i, v := range s.Vars {
+			out.Vars[i] = &parser.SetVar{Scope: v.Scope, Name: v.Name, Value: exprParams(v.Value, fn)}
+		}
+		return &out
+	}
+	return stmt
+}
+
+func rewriteSelectParams(sel *parser.SelectStmt, fn func(*parser.Param) parser.Expr) *parser.SelectStmt {
+	if sel == nil {
+		return nil
+	}
+	out := rewriteStmt(sel, func(expr parser.Expr) parser.Expr {
+		return exprParams(expr, fn)
+	})
+	out.With = rewriteWithParams(sel.With, fn)
+	out.Limit = exprParams(sel.Limit, fn)
+	out.Offset = exprParams(sel.Offset, fn)
+	return out
+}
+
+func rewriteWithParams(with []*parser.CTE, fn func(*parser.Param) parser.Expr) []*parser.CTE {
+	out := make([]*parser.CTE, len(with))
+	for i, c := range with {
+		def := *c
+		def.Select = rewriteSelectParams(c.Select, fn)
+		def.Union = rewriteSelectParams(c.Union, fn)
+		out[i] = &def
+	}
+	return out
+}
+
+// exprParams rewrites the placeholders of expr and of the subqueries in it
+func exprParams(expr parser.Expr, fn func(*parser.Param) parser.Expr) parser.Expr {
+	var rewrite func(parser.Expr) parser.Expr
+	rewrite = func(expr parser.Expr) parser.Expr {
+		switch e := expr.(type) {
+		case *parser.Param:
+			return fn(e)
+		case *parser.SubqueryExpr:
+			return &parser.SubqueryExpr{Select: rewriteSelectParams(e.Select, fn)}
+		case *parser.ExistsExpr:
+			return &parser.ExistsExpr{Subquery: &parser.SubqueryExpr{Select: rewriteSelectParams(e.Subquery.Select, fn)}}
+		case *parser.InExpr:
+			if e.Subquery != nil {
+				return &parser.InExpr{
+					Expr:     parser.Rewrite(e.Expr, rewrite),
+					Subquery: &parser.SubqueryExpr{Select: rewriteSelectParams(e.Subquery.Select, fn)},
+					Not:      e.Not,
+				}
+			}
+		}
+		return nil
+	}
+	return parser.Rewrite(expr, rewrite)
+}
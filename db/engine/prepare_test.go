@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlaceholders(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "joined", "2024-05-01")
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{"SELECT name FROM users WHERE country = ? AND age > ? ORDER BY name", []interface{}{"India", 35}, []string{"Cid"}},
+		{"SELECT name FROM users WHERE age BETWEEN $1 AND $2 OR name = $1 ORDER BY name", []interface{}{int64(30), uint8(35)}, []string{"Ann", "Dee"}},
+		{"SELECT name FROM users WHERE id IN (?, ?) ORDER BY name", []interface{}{[]byte("2"), "3"}, []string{"Bob", "Cid"}},
+		{"SELECT name FROM users WHERE age > ? ORDER BY name LIMIT ? OFFSET ?", []interface{}{20.5, 2, 1}, []string{"Bob", "Cid"}},
+		{"SELECT name FROM users WHERE joined = ?", []interface{}{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}, []string{"Ann"}},
+		{"SELECT name FROM users WHERE manager_id = ?", []interface{}{sql.NullString{String: "2", Valid: true}}, []string{"Cid", "Dee"}},
+		// NULL bound to a placeholder compares as unknown
+		{"SELECT name FROM users WHERE manager_id = ?", []interface{}{sql.NullString{}}, nil},
+		{"SELECT ?, ? IS NULL FROM users WHERE id = '1'", []interface{}{true, nil}, []string{"true | true"}},
+		{"SELECT name FROM users WHERE id IN (SELECT id FROM profiles WHERE city = ?)", []interface{}{"Leeds"}, []string{"Dee"}},
+		{"WITH c AS (SELECT name FROM users WHERE country = ?) SELECT name FROM c ORDER BY name", []interface{}{"USA"}, []string{"Bob", "Eve"}},
+		{"SELECT name FROM users WHERE id = ? UNION SELECT name FROM users WHERE id = ? ORDER BY name", []interface{}{"4", "5"}, []string{"Dee", "Eve"}},
+		// a bound value is never read as SQL
+		{"SELECT name FROM users WHERE name = ?", []interface{}{"x' OR '1' = '1"}, nil},
+	}
+	for _, tt := range tests {
+		got := queryRows(t, eng, tt.query, tt.args...)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s %v\n got %q\nwant %q", tt.query, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	stmt, err := eng.Prepare("SELECT name FROM users WHERE country = $1 AND age < $2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.NumParams() != 2 {
+		t.Errorf("NumParams() = %d, want 2", stmt.NumParams())
+	}
+	for country, want := range map[string]string{"India": "Ann", "USA": "Bob", "UK": "Dee"} {
+		res, err := stmt.Execute(context.Background(), country, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Rows) != 1 || res.Rows[0][0] != want {
+			t.Errorf("Execute(%s, 40) = %v, want %s", country, res.Rows, want)
+		}
+	}
+
+	again, err := eng.Prepare("SELECT name FROM users WHERE country = $1 AND age < $2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != stmt {
+		t.Error("preparing the same query again didn't return the cached statement")
+	}
+	eng.Dialect = MySQL
+	if mysql, err := eng.Prepare(stmt.String()); err != nil || mysql == stmt {
+		t.Errorf("preparing in another dialect returned the cached statement, err %v", err)
+	}
+}
+
+func TestPlaceholdersInShowAndSet(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	eng.Dialect = MySQL
+	show, err := eng.Prepare("SHOW TABLES LIKE ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if show.NumParams() != 1 {
+		t.Errorf("SHOW TABLES LIKE ?: NumParams() = %d, want 1", show.NumParams())
+	}
+	for pattern, want := range map[string]string{"us%": "[[users]]", "PRO%": "[[profiles]]", "x%": "[]"} {
+		res, err := show.Execute(context.Background(), pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(res.Rows); got != want {
+			t.Errorf("SHOW TABLES LIKE %q = %s, want %s", pattern, got, want)
+		}
+	}
+	if got := queryRows(t, eng, "SHOW VARIABLES LIKE $1", "version%"); len(got) != 2 {
+		t.Errorf("SHOW VARIABLES LIKE 'version%%' = %q, want 2 rows", got)
+	}
+	if got := queryRows(t, eng, "SHOW TABLES LIKE ?", nil); len(got) != 0 {
+		t.Errorf("SHOW TABLES LIKE NULL = %q, want no row", got)
+	}
+
+	set, err := eng.Prepare("SET autocommit = ?, SESSION sql_mode = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.NumParams() != 2 {
+		t.Errorf("SET with two placeholders: NumParams() = %d, want 2", set.NumParams())
+	}
+	if _, err := set.Execute(context.Background(), 1, ""); err != nil {
+		t.Errorf("SET: %v", err)
+	}
+	if _, err := set.Execute(context.Background(), 1); err == nil {
+		t.Error("SET with a missing argument: no error")
+	}
+}
+
+func TestPlaceholderErrors(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	tests := []struct {
+		query string
+		args  []interface{}
+		msg   string
+	}{
+		{"SELECT name FROM users WHERE id = ?", nil, "expects 1 argument, got 0"},
+		{"SELECT name FROM users WHERE id = $2", []interface{}{"1"}, "expects 2 arguments, got 1"},
+		{"SELECT name FROM users WHERE id = ?", []interface{}{struct{}{}}, "argument 1: unsupported type struct {}"},
+		{"SELECT name FROM users WHERE id = ?", []interface{}{uint64(1 << 63)}, "too large"},
+		{"SELECT name FROM users WHERE id = ? OR id = $1", []interface{}{"1"}, "cannot mix ? and $n placeholders"},
+		{"SELECT name FROM users WHERE id = $0", []interface{}{"1"}, "invalid placeholder $0"},
+	}
+	for _, tt := range tests {
+		_, err := eng.Query(context.Background(), tt.query, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%s %v: error = %v, want it to mention %q", tt.query, tt.args, err, tt.msg)
+		}
+	}
+}
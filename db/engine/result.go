@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Result is the output of a query: named columns and one value per column in each row
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+
+	// Analysis is what EXPLAIN ANALYZE measured: the statement run, with
+	// its operators as children. It is nil for other statements.
+	Analysis *Analysis
+}
+
+// Maps returns each row as a map from column name to value
+func (r *Result) Maps() []map[string]interface{} {
+	maps := make([]map[string]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		m := make(map[string]interface{}, len(r.Columns))
+		for j, col := range r.Columns {
+			m[col] = row[j]
+		}
+		maps[i] = m
+	}
+	return maps
+}
+
+// String renders the result as an aligned text table
+func (r *Result) String() string {
+	cells := make([][]string, len(r.Rows)+1)
+	cells[0] = r.Columns
+	for i, row := range r.Rows {
+		cells[i+1] = make([]string, len(row))
+		for j, v := range row {
+			cells[i+1][j] = formatValue(v)
+		}
+	}
+
+	widths := make([]int, len(r.Columns))
+	for _, line := range cells {
+		for j, cell := range line {
+			if n := len([]rune(cell)); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for i, line := range cells {
+		for j, cell := range line {
+			if j > 0 {
+				sb.WriteString(" | ")
+			}
+			sb.WriteString(cell)
+			if j < len(line)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[j]-len([]rune(cell))))
+			}
+		}
+		sb.WriteString("\n")
+		if i == 0 {
+			for j, w := range widths {
+				if j > 0 {
+					sb.WriteString("-+-")
+				}
+				sb.WriteString(strings.Repeat("-", w))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&sb, "(%d rows)", len(r.Rows))
+	return sb.String()
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	return toString(v)
+}
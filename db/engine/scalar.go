@@ -0,0 +1,453 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The built-in scalar functions. Unless noted otherwise a NULL argument
+// makes the result NULL, and values are converted the way comparisons
+// convert them: hash values holding numbers are numbers, those holding
+// dates are dates.
+
+// arity checks the number of arguments of a call of name
+func arity(name string, args []interface{}, min, max int) error {
+	switch {
+	case min == max && len(args) != min:
+		return fmt.Errorf("%s expects %d argument%s, got %d", name, min, plural(min), len(args))
+	case len(args) < min:
+		return fmt.Errorf("%s expects at least %d argument%s, got %d", name, min, plural(min), len(args))
+	case max >= 0 && len(args) > max:
+		return fmt.Errorf("%s expects at most %d arguments, got %d", name, max, len(args))
+	}
+	return nil
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func hasNull(args []interface{}) bool {
+	for _, arg := range args {
+		if arg == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// intArg converts an integer argument of name
+func intArg(name string, v interface{}) (int64, error) {
+	if n, ok := toInt(v); ok {
+		return n, nil
+	}
+	if f, ok := toFloat(v); ok && f == math.Trunc(f) {
+		return int64(f), nil
+	}
+	return 0, &TypeMismatchError{Context: name, Want: "an integer", Value: v}
+}
+
+// floatArg converts a numeric argument of name
+func floatArg(name string, v interface{}) (float64, error) {
+	f, ok := toFloat(v)
+	if !ok {
+		return 0, &TypeMismatchError{Context: name, Want: "a number", Value: v}
+	}
+	return f, nil
+}
+
+// stringFunc returns a function of one string argument
+func stringFunc(name string, fn func(string) interface{}) Function {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(name, args, 1, 1); err != nil || args[0] == nil {
+			return nil, err
+		}
+		return fn(toString(args[0])), nil
+	}
+}
+
+var (
+	upper      = stringFunc("UPPER", func(s string) interface{} { return strings.ToUpper(s) })
+	lower      = stringFunc("LOWER", func(s string) interface{} { return strings.ToLower(s) })
+	length     = stringFunc("LENGTH", func(s string) interface{} { return int64(len(s)) })
+	charLength = stringFunc("CHAR_LENGTH", func(s string) interface{} { return int64(utf8.RuneCountInString(s)) })
+)
+
+// trim returns a function removing spaces with fn
+func trim(name string, fn func(string) string) Function {
+	return stringFunc(name, func(s string) interface{} { return fn(s) })
+}
+
+// substring is SUBSTRING(s, pos [, len]), counting characters from 1. A
+// negative pos counts from the end of s.
+func substring(args []interface{}) (interface{}, error) {
+	if err := arity("SUBSTRING", args, 2, 3); err != nil || hasNull(args) {
+		return nil, err
+	}
+	runes := []rune(toString(args[0]))
+	pos, err := intArg("SUBSTRING", args[1])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case pos > 0:
+		pos--
+	case pos < 0:
+		pos += int64(len(runes))
+	default:
+		return "", nil
+	}
+	if pos < 0 || pos >= int64(len(runes)) {
+		return "", nil
+	}
+	end := int64(len(runes))
+	if len(args) == 3 {
+		n, err := intArg("SUBSTRING", args[2])
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return "", nil
+		}
+		if pos+n < end {
+			end = pos + n
+		}
+	}
+	return string(runes[pos:end]), nil
+}
+
+// edge returns LEFT(s, n) or, fromEnd, RIGHT(s, n): the first or last n
+// characters of s
+func edge(name string, fromEnd bool) Function {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(name, args, 2, 2); err != nil || hasNull(args) {
+			return nil, err
+		}
+		runes := []rune(toString(args[0]))
+		n, err := intArg(name, args[1])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case n <= 0:
+			return "", nil
+		case n >= int64(len(runes)):
+			return string(runes), nil
+		case fromEnd:
+			return string(runes[int64(len(runes))-n:]), nil
+		}
+		return string(runes[:n]), nil
+	}
+}
+
+// concat joins its arguments as text
+func concat(args []interface{}) (interface{}, error) {
+	if err := arity("CONCAT", args, 1, -1); err != nil || hasNull(args) {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(toString(arg))
+	}
+	return sb.String(), nil
+}
+
+// concatWS is CONCAT_WS(sep, s...), joining the strings with sep. NULL
+// strings are skipped; a NULL separator makes the result NULL.
+func concatWS(args []interface{}) (interface{}, error) {
+	if err := arity("CONCAT_WS", args, 2, -1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	var parts []string
+	for _, arg := range args[1:] {
+		if arg != nil {
+			parts = append(parts, toString(arg))
+		}
+	}
+	return strings.Join(parts, toString(args[0])), nil
+}
+
+// replace is REPLACE(s, from, to), replacing every occurrence of from
+func replace(args []interface{}) (interface{}, error) {
+	if err := arity("REPLACE", args, 3, 3); err != nil || hasNull(args) {
+		return nil, err
+	}
+	return strings.ReplaceAll(toString(args[0]), toString(args[1]), toString(args[2])), nil
+}
+
+// round is ROUND(x [, d]), rounding half away from zero to d decimals, or to
+// tens, hundreds, ... for a negative d. Integers stay integers.
+func round(args []interface{}) (interface{}, error) {
+	if err := arity("ROUND", args, 1, 2); err != nil || hasNull(args) {
+		return nil, err
+	}
+	var d int64
+	if len(args) == 2 {
+		var err error
+		if d, err = intArg("ROUND", args[1]); err != nil {
+			return nil, err
+		}
+	}
+	if n, ok := toInt(args[0]); ok {
+		r, ok := roundInt(n, d)
+		if !ok {
+			return nil, &OutOfRangeError{Expr: fmt.Sprintf("ROUND(%d, %d)", n, d)}
+		}
+		return r, nil
+	}
+	f, err := floatArg("ROUND", args[0])
+	if err != nil {
+		return nil, err
+	}
+	scale := math.Pow10(int(max(min(d, 400), -400)))
+	switch r := math.Round(f*scale) / scale; {
+	case math.IsInf(f*scale, 0):
+		return f, nil // more digits than a float holds
+	case scale == 0 || math.IsNaN(r):
+		return 0.0, nil
+	default:
+		return r, nil
+	}
+}
+
+// roundInt rounds n to -d digits left of the point, half away from zero,
+// reporting false when the result doesn't fit in an int64
+func roundInt(n, d int64) (int64, bool) {
+	scale := int64(1)
+	for ; d < 0; d++ {
+		if scale > math.MaxInt64/10 {
+			// 10^19 and above: n rounds to 0, or to ±10^19 when d is -19
+			return 0, d < -1 || n > -5e18 && n < 5e18
+		}
+		scale *= 10
+	}
+	q, r := n/scale, n%scale
+	switch {
+	case r*2 >= scale:
+		q++
+	case r*2 <= -scale:
+		q--
+	}
+	return mulInts(q, scale)
+}
+
+func abs(args []interface{}) (interface{}, error) {
+	if err := arity("ABS", args, 1, 1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	if n, ok := toInt(args[0]); ok {
+		if n < 0 {
+			return -n, nil
+		}
+		return n, nil
+	}
+	f, err := floatArg("ABS", args[0])
+	return math.Abs(f), err
+}
+
+func ceil(args []interface{}) (interface{}, error) {
+	return integral("CEIL", math.Ceil, args)
+}
+
+func floor(args []interface{}) (interface{}, error) {
+	return integral("FLOOR", math.Floor, args)
+}
+
+// integral rounds a number to an integer with fn
+func integral(name string, fn func(float64) float64, args []interface{}) (interface{}, error) {
+	if err := arity(name, args, 1, 1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	if n, ok := toInt(args[0]); ok {
+		return n, nil
+	}
+	f, err := floatArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return int64(fn(f)), nil
+}
+
+// now returns the current local time to the second. Like dates read from
+// hashes, it carries no zone, so it compares with them by wall clock.
+func now(args []interface{}) (interface{}, error) {
+	if err := arity("NOW", args, 0, 0); err != nil {
+		return nil, err
+	}
+	t := time.Now()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+}
+
+// currentDatabase is DATABASE(), the database the keyspace is to MySQL
+// clients
+func currentDatabase(args []interface{}) (interface{}, error) {
+	if err := arity("DATABASE", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// dateFormat is DATE_FORMAT(date, format) with MySQL's format specifiers,
+// such as '%Y-%m-%d %H:%i'. A value that isn't a date gives NULL.
+func dateFormat(args []interface{}) (interface{}, error) {
+	if err := arity("DATE_FORMAT", args, 2, 2); err != nil || hasNull(args) {
+		return nil, err
+	}
+	t, ok := toTime(args[0])
+	if !ok {
+		return nil, nil
+	}
+	format := toString(args[1])
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		sb.WriteString(dateSpecifier(t, format[i]))
+	}
+	return sb.String(), nil
+}
+
+// dateSpecifier renders the DATE_FORMAT specifier %c of t
+func dateSpecifier(t time.Time, c byte) string {
+	hour12 := t.Hour() % 12
+	if hour12 == 0 {
+		hour12 = 12
+	}
+	switch c {
+	case 'Y':
+		return fmt.Sprintf("%04d", t.Year())
+	case 'y':
+		return fmt.Sprintf("%02d", t.Year()%100)
+	case 'm':
+		return fmt.Sprintf("%02d", int(t.Month()))
+	case 'c':
+		return strconv.Itoa(int(t.Month()))
+	case 'M':
+		return t.Month().String()
+	case 'b':
+		return t.Month().String()[:3]
+	case 'd':
+		return fmt.Sprintf("%02d", t.Day())
+	case 'e':
+		return strconv.Itoa(t.Day())
+	case 'D':
+		return strconv.Itoa(t.Day()) + ordinalSuffix(t.Day())
+	case 'j':
+		return fmt.Sprintf("%03d", t.YearDay())
+	case 'W':
+		return t.Weekday().String()
+	case 'a':
+		return t.Weekday().String()[:3]
+	case 'w':
+		return strconv.Itoa(int(t.Weekday()))
+	case 'H':
+		return fmt.Sprintf("%02d", t.Hour())
+	case 'k':
+		return strconv.Itoa(t.Hour())
+	case 'h', 'I':
+		return fmt.Sprintf("%02d", hour12)
+	case 'l':
+		return strconv.Itoa(hour12)
+	case 'i':
+		return fmt.Sprintf("%02d", t.Minute())
+	case 's', 'S':
+		return fmt.Sprintf("%02d", t.Second())
+	case 'f':
+		return fmt.Sprintf("%06d", t.Nanosecond()/1000)
+	case 'p':
+		return t.Format("PM")
+	case 'T':
+		return t.Format("15:04:05")
+	case 'r':
+		return t.Format("03:04:05 PM")
+	}
+	return string(c)
+}
+
+func ordinalSuffix(day int) string {
+	if day/10 == 1 {
+		return "th"
+	}
+	switch day % 10 {
+	case 1:
+		return "st"
+	case 2:
+		return "nd"
+	case 3:
+		return "rd"
+	}
+	return "th"
+}
+
+// jsonExtract is JSON_EXTRACT(doc, path), reading the value at a path such
+// as '$.address.city' or '$.tags[0]' of a JSON document. Like nested fields
+// selected as address.city, scalars come back as strings and objects and
+// arrays as JSON text; a missing value is NULL.
+func jsonExtract(args []interface{}) (interface{}, error) {
+	if err := arity("JSON_EXTRACT", args, 2, 2); err != nil || hasNull(args) {
+		return nil, err
+	}
+	path, err := parseJSONPath(toString(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	return jsonPath(toString(args[0]), path), nil
+}
+
+// parseJSONPath splits a JSON path into object keys and array indexes:
+// "$.a[2].b" becomes a, 2, b. Keys can be quoted, as in $."first name".
+func parseJSONPath(path string) ([]string, error) {
+	invalid := fmt.Errorf("invalid JSON path %q", path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid
+	}
+	var steps []string
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.IndexByte(rest[1:], '"')
+				if end < 0 {
+					return nil, invalid
+				}
+				steps = append(steps, rest[1:end+1])
+				rest = rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, invalid
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+			if _, err := strconv.Atoi(rest[1:end]); err != nil {
+				return nil, invalid
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+	return steps, nil
+}
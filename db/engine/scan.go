@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// keyIterator yields the ids of a table's rows in batches of at most n ids.
+// next returns a nil slice once every id has been produced.
+type keyIterator interface {
+	next(ctx context.Context, n int) ([]string, error)
+}
+
+// rangeKeys yields the ids 1..count of a table with a known size, skipping
+// those that don't start with prefix without asking KeyDB
+type rangeKeys struct {
+	prefix string
+	count  int
+	pos    int
+}
+
+func (r *rangeKeys) next(ctx context.Context, n int) ([]string, error) {
+	var ids []string
+	for len(ids) < n && r.pos < r.count {
+		r.pos++
+		id := strconv.Itoa(r.pos)
+		if strings.HasPrefix(id, r.prefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// listKeys yields a fixed list of ids
+type listKeys struct {
+	ids []string
+}
+
+func (l *listKeys) next(ctx context.Context, n int) ([]string, error) {
+	if n > len(l.ids) {
+		n = len(l.ids)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	ids := l.ids[:n]
+	l.ids = l.ids[n:]
+	return ids, nil
+}
+
+// scanKeys discovers ids with SCAN MATCH
+type scanKeys struct {
+	rdb    *redis.Client
+	table  *Table // the ids are those of the keys found that follow its pattern
+	match  string
+	cursor uint64
+	done   bool
+	seen   map[string]bool
+	ids    listKeys // found by the last SCAN but not handed out yet
+}
+
+func (s *scanKeys) next(ctx context.Context, n int) ([]string, error) {
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	if len(s.ids.ids) > 0 {
+		return s.ids.next(ctx, n)
+	}
+	for !s.done {
+		keys, cursor, err := s.rdb.Scan(ctx, s.cursor, s.match, int64(n)).Result()
+		if err != nil {
+			return nil, backendError(err)
+		}
+		s.cursor = cursor
+		s.done = cursor == 0
+
+		// SCAN may return a key more than once
+		var ids []string
+		for _, key := range keys {
+			if !s.seen[key] {
+				s.seen[key] = true
+				if id, ok := s.table.id(key); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+		if len(ids) > 0 {
+			s.ids.ids = ids
+			return s.ids.next(ctx, n)
+		}
+	}
+	return nil, nil
+}
+
+// indexKeys looks ids up in an index sorted set, with ZRANGEBYLEX for a
+// lexicographic index and ZRANGEBYSCORE (or ZREVRANGEBYSCORE) for a score index
+type indexKeys struct {
+	rdb      *redis.Client
+	index    *Index
+	min, max string
+	reverse  bool
+	loaded   bool
+	ids      listKeys
+}
+
+func (x *indexKeys) next(ctx context.Context, n int) ([]string, error) {
+	if !x.loaded {
+		members, err := x.members(ctx)
+		if err != nil {
+			return nil, backendError(err)
+		}
+		for _, m := range members {
+			if x.index.Kind == ScoreIndex {
+				x.ids.ids = append(x.ids.ids, m)
+			} else if i := strings.LastIndexByte(m, 0); i >= 0 {
+				x.ids.ids = append(x.ids.ids, m[i+1:])
+			}
+		}
+		x.loaded = true
+	}
+	return x.ids.next(ctx, n)
+}
+
+func (x *indexKeys) members(ctx context.Context) ([]string, error) {
+	by := &redis.ZRangeBy{Min: x.min, Max: x.max}
+	switch {
+	case x.index.Kind == LexIndex:
+		return x.rdb.ZRangeByLex(ctx, x.index.Key, by).Result()
+	case x.reverse:
+		return x.rdb.ZRevRangeByScore(ctx, x.index.Key, by).Result()
+	}
+	return x.rdb.ZRangeByScore(ctx, x.index.Key, by).Result()
+}
+
+// hashes reads the given hashes in a single pipelined round trip. Keys that
+// don't exist, or don't hold a hash, come back as nil maps.
+func (e *Engine) hashes(ctx context.Context, keys []string) ([]map[string]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	cmds := make([]*redis.StringStringMapCmd, len(keys))
+	_, err := e.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !isWrongType(err) {
+		return nil, backendError(err)
+	}
+
+	out := make([]map[string]string, len(keys))
+	for i, cmd := range cmds {
+		fields, err := cmd.Result()
+		if err != nil {
+			if isWrongType(err) {
+				continue
+			}
+			return nil, backendError(err)
+		}
+		if len(fields) > 0 {
+			out[i] = fields
+		}
+	}
+	return out, nil
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"db-parse/parser"
+)
+
+// ScriptResult is the outcome of one statement of a script
+type ScriptResult struct {
+	Query  string     // the text of the statement
+	Pos    parser.Pos // where the statement starts in the script
+	Result *Result    // nil when Err is set
+	Err    error
+}
+
+// ExecScript runs the statements of a script, separated by ";", in order
+// and returns the outcome of each statement run. Comments and empty
+// statements are skipped. A failing statement, including one that doesn't
+// parse, stops the script unless continueOnError is set; its error is then
+// returned too, numbered with the statement. Statements of a script can't
+// have placeholders.
+func (e *Engine) ExecScript(ctx context.Context, script string, continueOnError bool) ([]*ScriptResult, error) {
+	var results []*ScriptResult
+	for i, s := range e.Dialect.syntax().ParseScript(script) {
+		r := &ScriptResult{Query: s.Text, Pos: s.Pos, Err: s.Err}
+		if r.Err == nil {
+			r.Result, r.Err = e.newStmt(s.Text, s.Stmt).Execute(ctx)
+		}
+		results = append(results, r)
+		if r.Err != nil && !continueOnError {
+			return results, fmt.Errorf("statement %d: %w", i+1, r.Err)
+		}
+	}
+	return results, nil
+}
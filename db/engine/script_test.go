@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const testScript = `-- users by country
+SELECT name FROM users WHERE country = 'UK';
+/* a failing statement */
+SELECT name + 1 FROM users WHERE id = '1';
+SELECT COUNT(*) FROM users; -- trailing comment
+`
+
+func TestExecScript(t *testing.T) {
+	eng, _ := newTestEngine(t)
+
+	results, err := eng.ExecScript(context.Background(), testScript, false)
+	if err == nil || !strings.HasPrefix(err.Error(), "statement 2: ") {
+		t.Errorf("ExecScript error = %v, want it to stop at statement 2", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("ExecScript ran %d statements, want 2", len(results))
+	}
+	if r := results[0]; r.Err != nil || r.Query != "SELECT name FROM users WHERE country = 'UK'" || r.Pos.Line != 2 ||
+		len(r.Result.Rows) != 1 || r.Result.Rows[0][0] != "Dee" {
+		t.Errorf("statement 1 = %+v", r)
+	}
+	if code, _ := ErrorCode(results[1].Err); results[1].Result != nil || code != 1292 || results[1].Pos.Line != 4 {
+		t.Errorf("statement 2 = %+v, want a 1292 error at line 4", results[1])
+	}
+
+	results, err = eng.ExecScript(context.Background(), testScript, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("ExecScript with continueOnError = %+v, want 3 results, the second failing", results)
+	}
+	if got := results[2].Result.Rows[0][0]; got != int64(5) {
+		t.Errorf("statement 3 = %v, want 5", got)
+	}
+}
+
+func TestExecScriptErrors(t *testing.T) {
+	eng, _ := newTestEngine(t)
+
+	// a statement that doesn't parse is reported at its position in the script
+	results, err := eng.ExecScript(context.Background(), "SELECT 1;\n\nSELECT name FROM users WHERE;\nSELECT 2", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "line 3, column 29") {
+		t.Errorf("results = %+v, want the second to fail at line 3, column 29", results)
+	}
+
+	_, err = eng.ExecScript(context.Background(), "SELECT name FROM users WHERE id = ?", false)
+	if err == nil || !strings.Contains(err.Error(), "statement 1: ") {
+		t.Errorf("placeholder in a script: error = %v", err)
+	}
+
+	// in the MySQL dialect \' doesn't end a string, so the ; after it
+	// doesn't end the statement
+	eng.Dialect = MySQL
+	results, err = eng.ExecScript(context.Background(), `SET NAMES utf8mb4; SELECT 'it\'s; fine'; SHOW DATABASES`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[1].Result.Rows[0][0] != "it's; fine" || results[2].Result.Rows[0][0] != "keydb" {
+		t.Errorf("MySQL script results = %+v", results)
+	}
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// setOp runs the two queries of a UNION, INTERSECT or EXCEPT and combines
+// their rows. Without ALL the result has no duplicate rows; with ALL a row
+// is kept as many times as it occurs in the left query (EXCEPT ALL: minus
+// its occurrences in the right one; INTERSECT ALL: at most as many times as
+// in the right one). The columns are named after those of the left query.
+func (e *Engine) setOp(ctx context.Context, s *parser.SetOpStmt, sc *scope) (*Result, error) {
+	if len(s.With) > 0 {
+		var err error
+		if sc, err = newScope(sc, s.With, s.Recursive); err != nil {
+			return nil, err
+		}
+	}
+	op := s.Op
+	if s.All {
+		op += " ALL"
+	}
+	ctx, end := analyzeStep(ctx, op)
+	left, err := e.exec(ctx, s.Left, sc)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.exec(ctx, s.Right, sc)
+	if err != nil {
+		return nil, err
+	}
+	if len(left.Columns) != len(right.Columns) {
+		return nil, fmt.Errorf("%s of queries returning %d and %d columns", s.Op, len(left.Columns), len(right.Columns))
+	}
+
+	res := &Result{Columns: left.Columns, Rows: e.Dialect.combine(s.Op, s.All, left.Rows, right.Rows)}
+	if err := e.Dialect.sortRows(res, s.OrderBy); err != nil {
+		return nil, err
+	}
+	if err := limitRows(res, s.Limit, s.Offset); err != nil {
+		return nil, err
+	}
+	end(len(res.Rows))
+	return res, nil
+}
+
+func (d Dialect) combine(op string, all bool, left, right [][]interface{}) [][]interface{} {
+	if op == "UNION" && all {
+		return append(append([][]interface{}(nil), left...), right...)
+	}
+
+	seen := make(map[string]bool) // rows returned, without ALL
+	counts := make(map[string]int)
+	if op != "UNION" {
+		for _, row := range right {
+			counts[d.valueKey(row...)]++
+		}
+	}
+	var rows [][]interface{}
+	keep := func(row []interface{}, key string) {
+		if all || !seen[key] {
+			seen[key] = true
+			rows = append(rows, row)
+		}
+	}
+	for _, row := range left {
+		key := d.valueKey(row...)
+		switch {
+		case op == "UNION":
+			keep(row, key)
+		case op == "INTERSECT" && counts[key] > 0:
+			counts[key]--
+			keep(row, key)
+		case op == "EXCEPT" && counts[key] > 0:
+			if all {
+				counts[key]--
+			}
+		case op == "EXCEPT":
+			keep(row, key)
+		}
+	}
+	if op == "UNION" {
+		for _, row := range right {
+			keep(row, d.valueKey(row...))
+		}
+	}
+	return rows
+}
+
+// sortRows sorts the rows of a set operation. Its ORDER BY can only name the
+// output columns, by name or position.
+func (d Dialect) sortRows(res *Result, items []*parser.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	cols := make([]int, len(items))
+	for i, item := range items {
+		cols[i] = -1
+		switch e := item.Expr.(type) {
+		case *parser.ColumnRef:
+			for j, name := range res.Columns {
+				if e.Table == "" && strings.EqualFold(name, e.Name) {
+					cols[i] = j
+					break
+				}
+			}
+		case *parser.Literal:
+			if n, ok := e.Value.(int64); ok && n >= 1 && int(n) <= len(res.Columns) {
+				cols[i] = int(n) - 1
+			}
+		}
+		if cols[i] < 0 {
+			return &UnknownColumnError{Column: item.Expr.String(), Clause: "ORDER BY"}
+		}
+	}
+	kinds := make([]sortKind, len(items))
+	for i := range items {
+		values := make([]interface{}, len(res.Rows))
+		for j, row := range res.Rows {
+			values[j] = row[cols[i]]
+		}
+		kinds[i] = kindOf(values)
+	}
+	sort.SliceStable(res.Rows, func(a, b int) bool {
+		for i, item := range items {
+			if c := d.compareSortKeys(res.Rows[a][cols[i]], res.Rows[b][cols[i]], item, kinds[i]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// limitRows applies LIMIT and OFFSET to the rows of a set operation
+func limitRows(res *Result, limit, offset parser.Expr) error {
+	if offset != nil {
+		n, err := countValue("OFFSET", offset)
+		if err != nil {
+			return err
+		}
+		if n > len(res.Rows) {
+			n = len(res.Rows)
+		}
+		res.Rows = res.Rows[n:]
+	}
+	if limit != nil {
+		n, err := countValue("LIMIT", limit)
+		if err != nil {
+			return err
+		}
+		if n < len(res.Rows) {
+			res.Rows = res.Rows[:n]
+		}
+	}
+	return nil
+}
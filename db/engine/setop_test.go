@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetOperations(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("archived_user:1", "name", "Zoe", "country", "UK")
+	mr.HSet("archived_user:2", "name", "Bob", "country", "USA")
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE country = 'UK' UNION ALL SELECT name FROM archived_user ORDER BY name", []string{"Bob", "Dee", "Zoe"}},
+		{"SELECT country FROM users UNION SELECT country FROM archived_user ORDER BY country", []string{"India", "UK", "USA"}},
+		{"SELECT country FROM users UNION ALL SELECT country FROM archived_user ORDER BY country LIMIT 3", []string{"India", "India", "UK"}},
+		{"SELECT name FROM users INTERSECT SELECT name FROM archived_user", []string{"Bob"}},
+		{"SELECT country FROM users EXCEPT SELECT country FROM archived_user", []string{"India"}},
+		{"SELECT country FROM users EXCEPT ALL SELECT country FROM archived_user ORDER BY country", []string{"India", "India", "USA"}},
+		// INTERSECT binds tighter than UNION
+		{"SELECT name FROM users WHERE id = '1' UNION SELECT name FROM users INTERSECT SELECT name FROM archived_user ORDER BY name", []string{"Ann", "Bob"}},
+		{"(SELECT name FROM users WHERE id = '1' UNION SELECT name FROM users WHERE id = '2') INTERSECT SELECT name FROM archived_user", []string{"Bob"}},
+		{"SELECT name AS n FROM users WHERE id = '1' UNION SELECT name FROM archived_user ORDER BY n DESC", []string{"Zoe", "Bob", "Ann"}},
+	})
+}
+
+func TestSetOperationColumns(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	res, err := eng.Query(context.Background(), "SELECT name AS n, age FROM users WHERE id = '1' UNION SELECT city, bio FROM profiles WHERE id = '2'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"n", "age"}; !reflect.DeepEqual(res.Columns, want) {
+		t.Errorf("columns = %q, want %q", res.Columns, want)
+	}
+
+	_, err = eng.Query(context.Background(), "SELECT name FROM users UNION SELECT city, bio FROM profiles")
+	if err == nil || !strings.Contains(err.Error(), "1 and 2 columns") {
+		t.Errorf("UNION of 1 and 2 columns: error = %v", err)
+	}
+}
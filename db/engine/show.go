@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// database is the name the MySQL dialect gives to the keyspace
+const database = "keydb"
+
+// variables are the server variables reported by SHOW VARIABLES, those
+// client libraries and tools commonly read when they connect
+var variables = [][2]string{
+	{"autocommit", "ON"},
+	{"character_set_client", "utf8mb4"},
+	{"character_set_connection", "utf8mb4"},
+	{"character_set_results", "utf8mb4"},
+	{"character_set_server", "utf8mb4"},
+	{"collation_connection", "utf8mb4_general_ci"},
+	{"collation_server", "utf8mb4_general_ci"},
+	{"lower_case_table_names", "1"},
+	{"max_allowed_packet", "67108864"},
+	{"sql_mode", ""},
+	{"system_time_zone", "UTC"},
+	{"time_zone", "SYSTEM"},
+	{"version", "8.0.0-keydb"},
+	{"version_comment", "db-parse on KeyDB"},
+}
+
+// variable reads a system variable of the MySQL dialect as SHOW VARIABLES
+// reports it, except that ON and OFF read as 1 and 0, as in MySQL. Both
+// scopes hold the same values.
+func (d Dialect) variable(v *parser.VarRef) (interface{}, error) {
+	if d != MySQL {
+		return nil, fmt.Errorf("%s requires the MySQL dialect", v)
+	}
+	for _, kv := range variables {
+		if !strings.EqualFold(kv[0], v.Name) {
+			continue
+		}
+		switch kv[1] {
+		case "ON":
+			return int64(1), nil
+		case "OFF":
+			return int64(0), nil
+		}
+		return kv[1], nil
+	}
+	return nil, fmt.Errorf("unknown system variable %s", v.Name)
+}
+
+// checkMySQL rejects the statements only the MySQL dialect accepts
+func (e *Engine) checkMySQL(stmt parser.Statement) error {
+	if e.Dialect != MySQL {
+		return fmt.Errorf("%s requires the MySQL dialect", stmt)
+	}
+	return nil
+}
+
+// set runs a SET statement, which changes nothing: the engine always talks
+// utf8mb4 and has no session state
+func (e *Engine) set(s *parser.SetStmt) (*Result, error) {
+	if err := e.checkMySQL(s); err != nil {
+		return nil, err
+	}
+	return &Result{}, nil
+}
+
+// show runs a SHOW statement, describing the registered tables as MySQL
+// would. Every column is text and id is the primary key.
+func (e *Engine) show(ctx context.Context, s *parser.ShowStmt) (*Result, error) {
+	if err := e.checkMySQL(s); err != nil {
+		return nil, err
+	}
+	like := func(string) bool { return true }
+	if s.Like != nil {
+		pattern, err := Eval(s.Like, nil)
+		if err != nil {
+			return nil, err
+		}
+		if pattern == nil {
+			like = func(string) bool { return false }
+		} else {
+			re, err := compilePattern("ILIKE", toString(pattern), defaultEscape)
+			if err != nil {
+				return nil, err
+			}
+			like = re.MatchString
+		}
+	}
+
+	result := &Result{}
+	switch s.What {
+	case "TABLES":
+		result.Columns = []string{"Tables_in_" + database}
+		if s.Full {
+			result.Columns = append(result.Columns, "Table_type")
+		}
+		var names []string
+		for _, t := range e.tables {
+			if like(t.Name) {
+				names = append(names, t.Name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			row := []interface{}{name}
+			if s.Full {
+				row = append(row, "BASE TABLE")
+			}
+			result.Rows = append(result.Rows, row)
+		}
+
+	case "DATABASES":
+		result.Columns = []string{"Database"}
+		if like(database) {
+			result.Rows = append(result.Rows, []interface{}{database})
+		}
+
+	case "COLUMNS":
+		t := e.table(s.Table)
+		fields, err := e.tableColumns(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		result.Columns = []string{"Field", "Type", "Null", "Key", "Default", "Extra"}
+		if s.Full {
+			result.Columns = []string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}
+		}
+		for i, field := range append([]string{"id"}, fields...) {
+			if !like(field) || i > 0 && field == "id" {
+				continue
+			}
+			null, key := "YES", ""
+			switch {
+			case field == "id":
+				null, key = "NO", "PRI"
+			case t.index(field, LexIndex) != nil, t.index(field, ScoreIndex) != nil:
+				key = "MUL"
+			}
+			row := []interface{}{field, "text", null, key, nil, ""}
+			if s.Full {
+				row = []interface{}{field, "text", "utf8mb4_general_ci", null, key, nil, "", "select", ""}
+			}
+			result.Rows = append(result.Rows, row)
+		}
+
+	case "INDEX":
+		t := e.table(s.Table)
+		result.Columns = []string{"Table", "Non_unique", "Key_name", "Seq_in_index", "Column_name", "Null", "Index_type"}
+		result.Rows = append(result.Rows, []interface{}{t.Name, int64(0), "PRIMARY", int64(1), "id", "", "HASH"})
+		for _, idx := range t.Indexes {
+			kind := "LEX"
+			if idx.Kind == ScoreIndex {
+				kind = "SCORE"
+			}
+			result.Rows = append(result.Rows, []interface{}{t.Name, int64(1), idx.Key, int64(1), idx.Column, "YES", kind})
+		}
+
+	case "VARIABLES":
+		result.Columns = []string{"Variable_name", "Value"}
+		for _, v := range variables {
+			if like(v[0]) {
+				result.Rows = append(result.Rows, []interface{}{v[0], v[1]})
+			}
+		}
+
+	case "WARNINGS":
+		result.Columns = []string{"Level", "Code", "Message"}
+
+	default:
+		return nil, &UnsupportedError{What: "statement " + s.String()}
+	}
+	return result, nil
+}
+
+// tableColumns returns the columns of t: those declared, or else the fields
+// of the first row found
+func (e *Engine) tableColumns(ctx context.Context, t *Table) ([]string, error) {
+	if len(t.Columns) > 0 {
+		return t.Columns, nil
+	}
+	var keys keyIterator = &scanKeys{rdb: e.rdb, table: t, match: t.match("")}
+	if t.Count > 0 {
+		keys = &rangeKeys{count: t.Count}
+	}
+	for {
+		ids, err := keys.next(ctx, batchSize)
+		if err != nil || ids == nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			ids[i] = t.key(id)
+		}
+		hashes, err := e.hashes(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, fields := range hashes {
+			if fields == nil {
+				continue
+			}
+			columns := make([]string, 0, len(fields))
+			for field := range fields {
+				columns = append(columns, field)
+			}
+			sort.Strings(columns)
+			return columns, nil
+		}
+	}
+}
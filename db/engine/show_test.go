@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMySQLCollation(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:6", "name", "ann ", "country", "india")
+	checkQueries(t, eng, []queryTest{
+		{"SELECT id FROM users WHERE name = 'ann' ORDER BY id", nil},
+		{"SELECT COUNT(DISTINCT country) FROM users", []string{"4"}},
+	})
+
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		// strings compare ignoring case and trailing spaces
+		{"SELECT id FROM users WHERE name = 'ann' ORDER BY id", []string{"1", "6"}},
+		{"SELECT id FROM users WHERE name = 'ANN   ' ORDER BY id", []string{"1", "6"}},
+		{"SELECT name FROM users WHERE name > 'cid' ORDER BY name", []string{"Dee", "Eve"}},
+		{"SELECT name FROM users WHERE name LIKE 'a%' ORDER BY id", []string{"Ann", "ann "}},
+		{"SELECT COUNT(DISTINCT country) FROM users", []string{"3"}},
+		{"SELECT name FROM users WHERE country IN ('INDIA') ORDER BY id", []string{"Ann", "Cid", "ann "}},
+	})
+}
+
+func TestMySQLQueries(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:1", "joined", "2024-05-01 08:05:09")
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		{"SELECT `name`, `u`.`age` FROM `users` `u` WHERE `u`.`id` = '1'", []string{"Ann | 30"}},
+		{"SELECT name FROM users ORDER BY name LIMIT 1, 2", []string{"Bob", "Cid"}},
+		{"SELECT IFNULL(manager_id, 'none'), CONCAT_WS(', ', name, country) FROM users WHERE id = '1'", []string{"none | Ann, India"}},
+		{"SELECT DATE_FORMAT(joined, '%d/%m/%Y') FROM users WHERE id = '1'", []string{"01/05/2024"}},
+		{"SELECT name FROM users WHERE joined < NOW()", []string{"Ann"}},
+	})
+}
+
+func TestPipesByDialect(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name || '/' || country FROM users WHERE id = '1'", []string{"Ann/India"}},
+	})
+
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE country = 'UK' || name = 'Bob' ORDER BY name", []string{"Bob", "Dee"}},
+		{"SELECT name FROM users WHERE age > 40 || age < 26 AND country = 'USA' ORDER BY name", []string{"Bob", "Cid"}},
+		{"SELECT age > 40 || manager_id IS NULL FROM users WHERE id IN ('1', '2') ORDER BY id", []string{"true", "false"}},
+		{"SELECT CONCAT(name, '/', country) FROM users WHERE id = '1'", []string{"Ann/India"}},
+	})
+}
+
+func TestShow(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		{"SHOW TABLES", []string{"profiles", "users"}},
+		{"SHOW FULL TABLES FROM keydb LIKE 'u%'", []string{"users | BASE TABLE"}},
+		{"SHOW DATABASES", []string{"keydb"}},
+		{"SHOW SCHEMAS LIKE 'x%'", nil},
+		{"SHOW COLUMNS FROM profiles", []string{
+			"id | text | NO | PRI | NULL | ",
+			"bio | text | YES |  | NULL | ",
+			"city | text | YES |  | NULL | ",
+			"country | text | YES |  | NULL | ",
+		}},
+		{"DESCRIBE users", []string{
+			"id | text | NO | PRI | NULL | ",
+			"age | text | YES | MUL | NULL | ",
+			"country | text | YES |  | NULL | ",
+			"email | text | YES |  | NULL | ",
+			"name | text | YES | MUL | NULL | ",
+		}},
+		{"SHOW FIELDS IN keydb.users LIKE 'n%'", []string{"name | text | YES | MUL | NULL | "}},
+		{"SHOW INDEX FROM users", []string{
+			"users | 0 | PRIMARY | 1 | id |  | HASH",
+			"users | 1 | idx:user:name | 1 | name | YES | LEX",
+			"users | 1 | idx:user:age | 1 | age | YES | SCORE",
+		}},
+		{"SHOW SESSION VARIABLES LIKE 'version%'", []string{"version | 8.0.0-keydb", "version_comment | db-parse on KeyDB"}},
+		{"SHOW WARNINGS", nil},
+	})
+
+	res, err := eng.Query(context.Background(), "SHOW FULL COLUMNS FROM users LIKE 'id'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}
+	if !reflect.DeepEqual(res.Columns, want) {
+		t.Errorf("SHOW FULL COLUMNS columns = %q, want %q", res.Columns, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	for _, query := range []string{"SET NAMES utf8mb4", "SHOW TABLES"} {
+		_, err := eng.Query(context.Background(), query)
+		if err == nil || !strings.Contains(err.Error(), "requires the MySQL dialect") {
+			t.Errorf("%s in the Standard dialect: error = %v", query, err)
+		}
+	}
+
+	eng.Dialect = MySQL
+	for _, query := range []string{
+		"SET NAMES utf8mb4",
+		"SET NAMES 'utf8mb4' COLLATE 'utf8mb4_unicode_ci'",
+		"SET autocommit = ON, SESSION sql_mode = 'STRICT_TRANS_TABLES'",
+		"set global max_allowed_packet = 1024 * 1024",
+	} {
+		res, err := eng.Query(context.Background(), query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+		} else if len(res.Columns) != 0 || len(res.Rows) != 0 {
+			t.Errorf("%s returned %v %v, want nothing", query, res.Columns, res.Rows)
+		}
+	}
+}
+
+func TestSelectWithoutFrom(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT 1", []string{"1"}},
+		{"SELECT 1 + 2 AS three, 'a' || 'b', UPPER('x'), NULL", []string{"3 | ab | X | NULL"}},
+		{"SELECT DATABASE(), SCHEMA()", []string{"keydb | keydb"}},
+		{"SELECT COUNT(*), MAX(2)", []string{"1 | 2"}},
+		{"SELECT 1 WHERE 1 = 0", nil},
+		{"SELECT (SELECT COUNT(*) FROM users), EXISTS (SELECT 1 FROM users WHERE age > 40)", []string{"5 | true"}},
+		{"SELECT name FROM users WHERE age = (SELECT 30)", []string{"Ann"}},
+		{"SELECT name, (SELECT u.age + 1) FROM users u WHERE id = '4'", []string{"Dee | 36"}},
+		{"SELECT 2 UNION SELECT 1 ORDER BY 1", []string{"1", "2"}},
+		{"WITH RECURSIVE n (i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 4) SELECT i FROM n", []string{"1", "2", "3", "4"}},
+	})
+
+	res, err := eng.Query(context.Background(), "SELECT NOW() AS t, 1 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"t", "1 + 1"}; !reflect.DeepEqual(res.Columns, want) || len(res.Rows) != 1 {
+		t.Errorf("SELECT NOW() AS t, 1 + 1 = %q %v, want columns %q and one row", res.Columns, res.Rows, want)
+	}
+
+	for query, msg := range map[string]string{
+		"SELECT *":    "no tables used",
+		"SELECT name": "unknown column name",
+		"SELECT id":   "unknown column id",
+	} {
+		_, err := eng.Query(context.Background(), query)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: error = %v, want it to mention %q", query, err, msg)
+		}
+	}
+}
+
+func TestSystemVariables(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	_, err := eng.Query(context.Background(), "SELECT @@version")
+	if err == nil || !strings.Contains(err.Error(), "@@version requires the MySQL dialect") {
+		t.Errorf("@@version in the Standard dialect: error = %v", err)
+	}
+
+	eng.Dialect = MySQL
+	checkQueries(t, eng, []queryTest{
+		{"SELECT @@version, @@VERSION_COMMENT, DATABASE()", []string{"8.0.0-keydb | db-parse on KeyDB | keydb"}},
+		{"SELECT @@session.autocommit, @@GLOBAL.max_allowed_packet, @@local.sql_mode", []string{"1 | 67108864 | "}},
+		{"SELECT name FROM users WHERE @@autocommit = 1 AND id = '1'", []string{"Ann"}},
+	})
+
+	res, err := eng.Query(context.Background(), "SELECT @@version, @@SESSION.time_zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"@@version", "@@session.time_zone"}; !reflect.DeepEqual(res.Columns, want) {
+		t.Errorf("columns = %q, want %q", res.Columns, want)
+	}
+
+	_, err = eng.Query(context.Background(), "SELECT @@no_such_variable")
+	if err == nil || !strings.Contains(err.Error(), "unknown system variable no_such_variable") {
+		t.Errorf("@@no_such_variable: error = %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"db-parse/parser"
+)
+
+// sortOp reads every row and returns them in ORDER BY order
+type sortOp struct {
+	q       *query
+	child   operator
+	project *projectOp
+	items   []*parser.OrderItem
+	rows    []*record
+	sorted  bool
+}
+
+func (s *sortOp) next(ctx context.Context) (*record, error) {
+	if !s.sorted {
+		if err := s.sort(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.rows) == 0 {
+		return nil, nil
+	}
+	rec := s.rows[0]
+	s.rows = s.rows[1:]
+	return rec, nil
+}
+
+func (s *sortOp) sort(ctx context.Context) error {
+	s.sorted = true
+	var keys [][]interface{}
+	for {
+		rec, err := s.child.next(ctx)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			break
+		}
+		key := make([]interface{}, len(s.items))
+		for i, item := range s.items {
+			if key[i], err = s.sortValue(ctx, rec, item.Expr); err != nil {
+				return err
+			}
+		}
+		s.rows = append(s.rows, rec)
+		keys = append(keys, key)
+	}
+
+	idx := make([]int, len(s.rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	kinds := make([]sortKind, len(s.items))
+	for i := range s.items {
+		values := make([]interface{}, len(keys))
+		for j, key := range keys {
+			values[j] = key[i]
+		}
+		kinds[i] = kindOf(values)
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ka, kb := keys[idx[a]], keys[idx[b]]
+		for i, item := range s.items {
+			if c := s.q.e.Dialect.compareSortKeys(ka[i], kb[i], item, kinds[i]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	rows := make([]*record, len(idx))
+	for i, j := range idx {
+		rows[i] = s.rows[j]
+	}
+	s.rows = rows
+	return nil
+}
+
+// sortValue evaluates an ORDER BY expression for a row. A bare name matching
+// an output column, or a column position such as ORDER BY 2, sorts by that
+// output column; anything else is evaluated against the row.
+func (s *sortOp) sortValue(ctx context.Context, rec *record, expr parser.Expr) (interface{}, error) {
+	switch e := expr.(type) {
+	case *parser.ColumnRef:
+		if e.Table == "" {
+			for i, name := range s.project.columns {
+				if strings.EqualFold(name, e.Name) {
+					return rec.values[i], nil
+				}
+			}
+		}
+	case *parser.Literal:
+		if n, ok := e.Value.(int64); ok && n >= 1 && int(n) <= len(rec.values) {
+			return rec.values[n-1], nil
+		}
+	}
+	return s.q.eval(ctx, expr, rec)
+}
+
+// compareSortKeys orders two sort key values for an ORDER BY item, compared
+// as kind. NULLs come first in ascending order and last in descending order
+// unless NULLS FIRST or NULLS LAST says otherwise.
+func (d Dialect) compareSortKeys(a, b interface{}, item *parser.OrderItem, kind sortKind) int {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0
+		}
+		nullsFirst := item.Nulls == parser.NullsFirst || item.Nulls == parser.NullsDefault && !item.Desc
+		if (a == nil) == nullsFirst {
+			return -1
+		}
+		return 1
+	}
+	c := d.sortOrder(a, b, kind)
+	if item.Desc {
+		return -c
+	}
+	return c
+}
+
+// sortKind is how the values of a sort key compare. A single kind is picked
+// for all the values of a key: comparing each pair by what it holds, "2" <
+// "10" as numbers but "10" < "1a" < "2" as text, wouldn't be a total order.
+type sortKind int
+
+const (
+	textSort   sortKind = iota // collated text
+	numberSort                 // every value holds a number, such as the hash strings "9" and "10"
+	timeSort                   // every value is a date or timestamp
+)
+
+// kindOf returns the sort kind of a key from its values, NULLs aside
+func kindOf(values []interface{}) sortKind {
+	numbers, times := true, true
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if !holdsNumber(v) {
+			numbers = false
+		}
+		if !isTime(v) {
+			times = false
+		}
+	}
+	switch {
+	case numbers:
+		return numberSort
+	case times:
+		return timeSort
+	}
+	return textSort
+}
+
+// holdsNumber reports whether v is, or is a string holding, a number other
+// than NaN, which doesn't order
+func holdsNumber(v interface{}) bool {
+	f, ok := toFloat(v)
+	return ok && !math.IsNaN(f)
+}
+
+// sortOrder compares two non-NULL values of a sort key of kind
+func (d Dialect) sortOrder(a, b interface{}, kind sortKind) int {
+	switch kind {
+	case numberSort:
+		c, _ := compareNumbers(a, b)
+		return c
+	case timeSort:
+		return a.(time.Time).Compare(b.(time.Time))
+	}
+	return strings.Compare(d.collate(toString(a)), d.collate(toString(b)))
+}
@@ -0,0 +1,41 @@
+package engine
+
+import "testing"
+
+func TestOrderBy(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("user:6", "name", "Fay", "age", "9", "country", "UK")
+	checkQueries(t, eng, []queryTest{
+		// ages sort as numbers: 9 before 25
+		{"SELECT name, age FROM users WHERE age IS NOT NULL ORDER BY age", []string{"Fay | 9", "Bob | 25", "Ann | 30", "Dee | 35", "Cid | 41"}},
+		{"SELECT name FROM users ORDER BY name DESC", []string{"Fay", "Eve", "Dee", "Cid", "Bob", "Ann"}},
+		{"SELECT name FROM users ORDER BY country, age DESC", []string{"Cid", "Ann", "Dee", "Fay", "Bob", "Eve"}},
+		{"SELECT name FROM users ORDER BY age NULLS FIRST", []string{"Eve", "Fay", "Bob", "Ann", "Dee", "Cid"}},
+		{"SELECT name FROM users ORDER BY age DESC NULLS LAST", []string{"Cid", "Dee", "Ann", "Bob", "Fay", "Eve"}},
+		{"SELECT name, age + 1 AS next FROM users WHERE country = 'UK' ORDER BY next", []string{"Fay | 10", "Dee | 36"}},
+		{"SELECT country, name FROM users WHERE country = 'India' ORDER BY 2 DESC", []string{"India | Cid", "India | Ann"}},
+		// age has a score index: ZRANGEBYSCORE returns the rows in order
+		{"SELECT name FROM users WHERE age > 20 ORDER BY age", []string{"Bob", "Ann", "Dee", "Cid"}},
+		{"SELECT name FROM users WHERE age > 20 ORDER BY age DESC", []string{"Cid", "Dee", "Ann", "Bob"}},
+		{"SELECT name, age AS age FROM users WHERE age > 20 ORDER BY age DESC", []string{"Cid | 41", "Dee | 35", "Ann | 30", "Bob | 25"}},
+		// unless an alias of the SELECT list shadows the indexed column
+		{"SELECT name, 0 - age AS age FROM users WHERE age > 20 ORDER BY age", []string{"Cid | -41", "Dee | -35", "Ann | -30", "Bob | -25"}},
+		{"SELECT name AS age FROM users WHERE age > 20 ORDER BY age DESC", []string{"Dee", "Cid", "Bob", "Ann"}},
+	})
+}
+
+// TestOrderByMixedValues checks that a key holding both numbers and other
+// text sorts as text throughout, which is a total order
+func TestOrderByMixedValues(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	for id, code := range map[string]string{"1": "2", "2": "10", "3": "1a", "4": "b"} {
+		mr.HSet("user:"+id, "code", code)
+	}
+	checkQueries(t, eng, []queryTest{
+		{"SELECT code FROM users WHERE id IN ('1', '2') ORDER BY code", []string{"2", "10"}},
+		{"SELECT code FROM users ORDER BY code", []string{"NULL", "10", "1a", "2", "b"}},
+		{"SELECT code FROM users ORDER BY code DESC", []string{"b", "2", "1a", "10", "NULL"}},
+		{"SELECT code FROM users WHERE id <> '4' UNION SELECT '9' ORDER BY code", []string{"NULL", "10", "1a", "2", "9"}},
+		{"SELECT code FROM users WHERE id IN ('1', '2') UNION SELECT '9' ORDER BY code", []string{"2", "9", "10"}},
+	})
+}
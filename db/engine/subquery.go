@@ -0,0 +1,311 @@
+package engine
+
+import (
+	"context"
+	"strings"
+
+	"db-parse/parser"
+)
+
+// subqueries runs the subqueries of a statement and caches their results by
+// the text of the statement run, so that a correlated subquery runs once for
+// each distinct set of outer values.
+//
+// A subquery is uncorrelated when none of its columns is qualified with the
+// name of a table of the enclosing query. Those run once, before the
+// enclosing query is planned, and are replaced by their result: an IN
+// (SELECT ...) then becomes an IN list, which on id or key turns the outer
+// scan into direct reads of the matching keys, a semi-join. Correlated
+// subqueries run for each row, with the outer columns replaced by the values
+// of the row.
+type subqueries struct {
+	e     *Engine
+	scope *scope
+	cache map[string]*Result
+}
+
+// replace returns expr with the subqueries bind returns a statement for
+// replaced by the result of that statement. A nil statement leaves the
+// subquery in place.
+func (s *subqueries) replace(ctx context.Context, expr parser.Expr, bind func(*parser.SelectStmt) *parser.SelectStmt) (parser.Expr, error) {
+	var err error
+	var fn func(parser.Expr) parser.Expr
+	fn = func(expr parser.Expr) parser.Expr {
+		if err != nil {
+			return expr
+		}
+		switch e := expr.(type) {
+		case *parser.SubqueryExpr:
+			sel := bind(e.Select)
+			if sel == nil {
+				return nil
+			}
+			var v interface{}
+			v, err = s.scalar(analyzeSubquery(ctx, e.Select, sel), sel)
+			return &parser.Literal{Value: v}
+		case *parser.ExistsExpr:
+			sel := bind(e.Subquery.Select)
+			if sel == nil {
+				return nil
+			}
+			var found bool
+			found, err = s.exists(analyzeSubquery(ctx, e.Subquery.Select, sel), sel)
+			return &parser.Literal{Value: found}
+		case *parser.InExpr:
+			if e.Subquery == nil {
+				return nil
+			}
+			sel := bind(e.Subquery.Select)
+			if sel == nil {
+				return nil
+			}
+			in := &parser.InExpr{Expr: parser.Rewrite(e.Expr, fn), Not: e.Not}
+			in.List, err = s.list(analyzeSubquery(ctx, e.Subquery.Select, sel), sel)
+			return in
+		}
+		return nil
+	}
+	out := parser.Rewrite(expr, fn)
+	return out, err
+}
+
+func (s *subqueries) run(ctx context.Context, sel *parser.SelectStmt) (*Result, error) {
+	text := sel.String()
+	if res, ok := s.cache[text]; ok {
+		return res, nil
+	}
+	end := analyzeRun(ctx)
+	res, err := s.e.run(ctx, sel, s.scope)
+	if err != nil {
+		return nil, err
+	}
+	end(len(res.Rows))
+	s.cache[text] = res
+	return res, nil
+}
+
+// scalar returns the single value of a subquery used as an expression, NULL
+// when it returns no row
+func (s *subqueries) scalar(ctx context.Context, sel *parser.SelectStmt) (interface{}, error) {
+	res, err := s.run(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	if err := singleColumn(res); err != nil {
+		return nil, err
+	}
+	switch len(res.Rows) {
+	case 0:
+		return nil, nil
+	case 1:
+		return res.Rows[0][0], nil
+	}
+	return nil, &SubqueryRowsError{}
+}
+
+// exists reports whether a subquery returns a row, reading at most one
+func (s *subqueries) exists(ctx context.Context, sel *parser.SelectStmt) (bool, error) {
+	if sel.Limit == nil {
+		first := *sel
+		first.Limit = &parser.Literal{Value: int64(1)}
+		sel = &first
+	}
+	res, err := s.run(ctx, sel)
+	if err != nil {
+		return false, err
+	}
+	return len(res.Rows) > 0, nil
+}
+
+// list returns the values of an IN subquery as literals
+func (s *subqueries) list(ctx context.Context, sel *parser.SelectStmt) ([]parser.Expr, error) {
+	res, err := s.run(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Rows) == 0 {
+		return nil, nil
+	}
+	if err := singleColumn(res); err != nil {
+		return nil, err
+	}
+	list := make([]parser.Expr, len(res.Rows))
+	for i, row := range res.Rows {
+		list[i] = &parser.Literal{Value: row[0]}
+	}
+	return list, nil
+}
+
+func singleColumn(res *Result) error {
+	if len(res.Columns) != 1 {
+		return &SubqueryColumnsError{Columns: len(res.Columns)}
+	}
+	return nil
+}
+
+// resolveUncorrelated returns a copy of stmt with its uncorrelated
+// subqueries replaced by their results
+func (s *subqueries) resolveUncorrelated(ctx context.Context, stmt *parser.SelectStmt) (*parser.SelectStmt, error) {
+	names := refNames(stmt)
+	bind := func(sel *parser.SelectStmt) *parser.SelectStmt {
+		if len(outerRefs(sel, names)) > 0 {
+			return nil
+		}
+		return sel
+	}
+	var err error
+	out := rewriteStmt(stmt, func(expr parser.Expr) parser.Expr {
+		if err != nil || !hasSubquery(expr) {
+			return expr
+		}
+		expr, err = s.replace(ctx, expr, bind)
+		return expr
+	})
+	return out, err
+}
+
+// bindOuter returns a copy of sel, a subquery of a query over the tables
+// named outer, with the outer columns replaced by their values in row
+func bindOuter(sel *parser.SelectStmt, row Row, outer []string) *parser.SelectStmt {
+	visible := shadow(outer, refNames(sel))
+	var fn func(parser.Expr) parser.Expr
+	fn = func(expr parser.Expr) parser.Expr {
+		switch e := expr.(type) {
+		case *parser.ColumnRef:
+			if e.Table != "" && containsFold(visible, e.Table) {
+				return &parser.Literal{Value: row[e.String()]}
+			}
+		case *parser.SubqueryExpr:
+			return &parser.SubqueryExpr{Select: bindOuter(e.Select, row, visible)}
+		case *parser.ExistsExpr:
+			return &parser.ExistsExpr{Subquery: &parser.SubqueryExpr{Select: bindOuter(e.Subquery.Select, row, visible)}}
+		case *parser.InExpr:
+			if e.Subquery != nil {
+				return &parser.InExpr{
+					Expr:     parser.Rewrite(e.Expr, fn),
+					Subquery: &parser.SubqueryExpr{Select: bindOuter(e.Subquery.Select, row, visible)},
+					Not:      e.Not,
+				}
+			}
+		}
+		return nil
+	}
+	return rewriteStmt(sel, func(expr parser.Expr) parser.Expr {
+		return parser.Rewrite(expr, fn)
+	})
+}
+
+// outerRefs returns the columns of sel, and of the subqueries nested in it,
+// that refer to the tables named outer of an enclosing query
+func outerRefs(sel *parser.SelectStmt, outer []string) []*parser.ColumnRef {
+	visible := shadow(outer, refNames(sel))
+	if len(visible) == 0 {
+		return nil
+	}
+	var refs []*parser.ColumnRef
+	for _, expr := range stmtExprs(sel) {
+		parser.Walk(expr, func(e parser.Expr) bool {
+			switch e := e.(type) {
+			case *parser.ColumnRef:
+				if e.Table != "" && containsFold(visible, e.Table) {
+					refs = append(refs, e)
+				}
+			case *parser.SubqueryExpr:
+				refs = append(refs, outerRefs(e.Select, visible)...)
+			}
+			return true
+		})
+	}
+	return refs
+}
+
+// hasSubquery reports whether expr contains a subquery
+func hasSubquery(expr parser.Expr) bool {
+	found := false
+	parser.Walk(expr, func(e parser.Expr) bool {
+		if _, ok := e.(*parser.SubqueryExpr); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// stmtExprs returns the expressions of every clause of sel
+func stmtExprs(sel *parser.SelectStmt) []parser.Expr {
+	var exprs []parser.Expr
+	for _, f := range sel.Fields {
+		exprs = append(exprs, f.Expr)
+	}
+	for _, j := range sel.Joins {
+		exprs = append(exprs, j.On)
+	}
+	exprs = append(exprs, sel.Where)
+	exprs = append(exprs, sel.GroupBy...)
+	exprs = append(exprs, sel.Having)
+	for _, item := range sel.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	return exprs
+}
+
+// rewriteStmt returns a copy of sel with the expressions of every clause
+// passed through fn
+func rewriteStmt(sel *parser.SelectStmt, fn func(parser.Expr) parser.Expr) *parser.SelectStmt {
+	out := *sel
+	out.Fields = make([]*parser.SelectField, len(sel.Fields))
+	for i, f := range sel.Fields {
+		out.Fields[i] = &parser.SelectField{Expr: fn(f.Expr), Alias: f.Alias}
+	}
+	out.Joins = make([]*parser.Join, len(sel.Joins))
+	for i, j := range sel.Joins {
+		out.Joins[i] = &parser.Join{Table: j.Table, On: fn(j.On)}
+	}
+	if sel.Where != nil {
+		out.Where = fn(sel.Where)
+	}
+	out.GroupBy = make([]parser.Expr, len(sel.GroupBy))
+	for i, expr := range sel.GroupBy {
+		out.GroupBy[i] = fn(expr)
+	}
+	if sel.Having != nil {
+		out.Having = fn(sel.Having)
+	}
+	out.OrderBy = make([]*parser.OrderItem, len(sel.OrderBy))
+	for i, item := range sel.OrderBy {
+		out.OrderBy[i] = &parser.OrderItem{Expr: fn(item.Expr), Desc: item.Desc, Nulls: item.Nulls}
+	}
+	return &out
+}
+
+// refNames returns the names the tables of sel are referenced by
+func refNames(sel *parser.SelectStmt) []string {
+	var names []string
+	if sel.From != nil {
+		names = append(names, sel.From.RefName())
+	}
+	for _, j := range sel.Joins {
+		names = append(names, j.Table.RefName())
+	}
+	return names
+}
+
+// shadow returns the names of outer not hidden by a name of inner
+func shadow(outer, inner []string) []string {
+	var visible []string
+	for _, name := range outer {
+		if !containsFold(inner, name) {
+			visible = append(visible, name)
+		}
+	}
+	return visible
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
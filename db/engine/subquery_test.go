@@ -0,0 +1,22 @@
+package engine
+
+import "testing"
+
+func TestSubqueries(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM users WHERE id IN (SELECT id FROM profiles WHERE country = 'USA') ORDER BY name", []string{"Ann", "Bob"}},
+		{"SELECT name FROM users WHERE id NOT IN (SELECT id FROM profiles) ORDER BY name", []string{"Cid", "Eve"}},
+		{"SELECT name FROM users WHERE age > (SELECT AVG(age) FROM users) ORDER BY name", []string{"Cid", "Dee"}},
+		{"SELECT name, (SELECT COUNT(*) FROM users) AS total FROM users WHERE id = '1'", []string{"Ann | 5"}},
+		{"SELECT name FROM users WHERE EXISTS (SELECT 1 FROM profiles WHERE city = 'Leeds') AND id = '1'", []string{"Ann"}},
+		{"SELECT name FROM users WHERE NOT EXISTS (SELECT 1 FROM profiles WHERE city = 'Paris') AND id = '1'", []string{"Ann"}},
+		// correlated subqueries run for each row, with its values
+		{"SELECT name FROM users u WHERE EXISTS (SELECT 1 FROM profiles p WHERE p.id = u.id) ORDER BY name", []string{"Ann", "Bob", "Dee"}},
+		{"SELECT u.name, (SELECT bio FROM profiles p WHERE p.id = u.manager_id) AS boss FROM users u ORDER BY u.name", []string{
+			"Ann | NULL", "Bob | likes tea", "Cid | likes golf", "Dee | likes golf", "Eve | likes rain",
+		}},
+		{"SELECT name FROM users u WHERE age > (SELECT MIN(age) FROM users m WHERE m.country = u.country) ORDER BY name", []string{"Cid"}},
+		{"SELECT name FROM users WHERE id IN (SELECT manager_id FROM users WHERE country = 'India')", []string{"Bob"}},
+	})
+}
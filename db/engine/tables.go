@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// idPlaceholder stands for the id in a key pattern
+const idPlaceholder = "{id}"
+
+// init checks the key pattern of t and splits it around the id, or makes it
+// from Prefix when there is none
+func (t *Table) init() error {
+	if t.Pattern == "" {
+		t.Pattern, t.suffix = t.Prefix+idPlaceholder, ""
+		return nil
+	}
+	if strings.Count(t.Pattern, idPlaceholder) != 1 {
+		return fmt.Errorf("key pattern %q of table %s must hold %s once", t.Pattern, t.Name, idPlaceholder)
+	}
+	t.Prefix, t.suffix, _ = strings.Cut(t.Pattern, idPlaceholder)
+	return nil
+}
+
+// key returns the key of the row of t with the given id
+func (t *Table) key(id string) string {
+	return t.Prefix + id + t.suffix
+}
+
+// id returns the id of the row of t stored under key, and whether key
+// follows the pattern of t at all
+func (t *Table) id(key string) (string, bool) {
+	if len(key) < len(t.Prefix)+len(t.suffix) || !strings.HasPrefix(key, t.Prefix) || !strings.HasSuffix(key, t.suffix) {
+		return key, false
+	}
+	return key[len(t.Prefix) : len(key)-len(t.suffix)], true
+}
+
+// match returns the SCAN MATCH pattern of the keys of t whose id starts
+// with prefix
+func (t *Table) match(prefix string) string {
+	return globEscape(t.Prefix+prefix) + "*" + globEscape(t.suffix)
+}
+
+// LoadTables registers the tables of a JSON file mapping table names to key
+// patterns, or to objects that also hold the other settings of a Table:
+//
+//	{
+//	    "users": "user:{id}",
+//	    "profiles": {"pattern": "user_profile:{id}", "columns": ["bio", "city"]},
+//	    "orders": {
+//	        "pattern": "order:{id}",
+//	        "count": 500,
+//	        "indexes": [{"column": "total", "key": "idx:order:total", "kind": "score"}]
+//	    }
+//	}
+//
+// Index kinds are "lex", the default, and "score". No table is registered
+// unless the whole file is valid.
+func (e *Engine) LoadTables(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tables, err := parseTables(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, t := range tables {
+		e.tables[strings.ToLower(t.Name)] = t
+	}
+	return nil
+}
+
+// tableConfig is a table of a file read by LoadTables
+type tableConfig struct {
+	Pattern string         `json:"pattern"`
+	Count   int            `json:"count"`
+	Columns []string       `json:"columns"`
+	Indexes []*indexConfig `json:"indexes"`
+}
+
+type indexConfig struct {
+	Column string `json:"column"`
+	Key    string `json:"key"`
+	Kind   string `json:"kind"`
+}
+
+// parseTables decodes the tables of a file read by LoadTables, by name
+func parseTables(data []byte) ([]*Table, error) {
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tables := make([]*Table, len(names))
+	for i, name := range names {
+		t, err := parseTable(name, config[name])
+		if err != nil {
+			return nil, err
+		}
+		tables[i] = t
+	}
+	return tables, nil
+}
+
+// parseTable decodes a table given as a key pattern or as a tableConfig
+func parseTable(name string, data json.RawMessage) (*Table, error) {
+	var c tableConfig
+	if err := json.Unmarshal(data, &c.Pattern); err != nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return nil, fmt.Errorf("table %s: %v", name, err)
+		}
+	}
+	if c.Pattern == "" {
+		return nil, fmt.Errorf("table %s has no key pattern", name)
+	}
+
+	t := &Table{Name: name, Pattern: c.Pattern, Count: c.Count, Columns: c.Columns}
+	for _, ic := range c.Indexes {
+		if ic.Column == "" || ic.Key == "" {
+			return nil, fmt.Errorf("index of table %s needs a column and a key", name)
+		}
+		idx := &Index{Column: ic.Column, Key: ic.Key}
+		switch strings.ToLower(ic.Kind) {
+		case "", "lex":
+			idx.Kind = LexIndex
+		case "score":
+			idx.Kind = ScoreIndex
+		default:
+			return nil, fmt.Errorf("index %s of table %s has unknown kind %q", ic.Key, name, ic.Kind)
+		}
+		t.Indexes = append(t.Indexes, idx)
+	}
+	return t, t.init()
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyPatterns(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("acct:7:info", "owner", "Ann", "plan", "pro")
+	mr.HSet("acct:8:info", "owner", "Bob", "plan", "free")
+	mr.HSet("acct:7:limits", "owner", "not a row")
+	mr.HSet("order:1", "total", "12")
+	mr.HSet("order:2", "total", "30")
+	mr.HSet("order:3", "total", "7")
+	for _, table := range []*Table{
+		{Name: "Accounts", Pattern: "acct:{id}:info"},
+		{Name: "orders", Prefix: "order:", Count: 2, Columns: []string{"total", "note"}},
+	} {
+		if err := eng.AddTable(table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkQueries(t, eng, []queryTest{
+		{"SELECT id, key, owner FROM accounts ORDER BY id", []string{"7 | acct:7:info | Ann", "8 | acct:8:info | Bob"}},
+		{"SELECT owner FROM ACCOUNTS WHERE id = '8'", []string{"Bob"}},
+		{"SELECT a.owner, u.email FROM accounts a JOIN users u ON u.name = a.owner ORDER BY a.owner", []string{
+			"Ann | ann@example.com", "Bob | bob@example.com",
+		}},
+		// Count bounds the ids read, and Columns are those of *
+		{"SELECT * FROM orders", []string{"12 | NULL", "30 | NULL"}},
+		// tables that aren't registered map to <name>:<id>
+		{"SELECT total FROM `order` ORDER BY total", []string{"7", "12", "30"}},
+		{"SELECT bio FROM user_profile WHERE id = '4'", []string{"likes rain"}},
+	})
+}
+
+func TestAddTableErrors(t *testing.T) {
+	eng, _ := newTestEngine(t)
+	for _, pattern := range []string{"user:*", "user:{id}:{id}"} {
+		err := eng.AddTable(&Table{Name: "broken", Pattern: pattern})
+		if err == nil || !strings.Contains(err.Error(), "must hold {id} once") {
+			t.Errorf("AddTable with pattern %q: error = %v", pattern, err)
+		}
+	}
+	if _, ok := eng.tables["broken"]; ok {
+		t.Error("AddTable registered a table with an invalid pattern")
+	}
+}
+
+func TestLoadTables(t *testing.T) {
+	eng, mr := newTestEngine(t)
+	mr.HSet("order:1", "total", "12")
+	mr.HSet("order:2", "total", "30")
+	mr.ZAdd("idx:order:total", 12, "1")
+	mr.ZAdd("idx:order:total", 30, "2")
+	path := writeFile(t, `{
+		"people": "user:{id}",
+		"bios": {"pattern": "user_profile:{id}", "columns": ["bio"]},
+		"orders": {
+			"pattern": "order:{id}",
+			"count": 2,
+			"indexes": [{"column": "total", "key": "idx:order:total", "kind": "score"}]
+		}
+	}`)
+	if err := eng.LoadTables(path); err != nil {
+		t.Fatal(err)
+	}
+	checkQueries(t, eng, []queryTest{
+		{"SELECT name FROM people WHERE id = '3'", []string{"Cid"}},
+		{"SELECT * FROM bios WHERE id = '1'", []string{"likes tea"}},
+		{"SELECT id FROM orders WHERE total > 20", []string{"2"}},
+		{"EXPLAIN SELECT id FROM orders WHERE total > 20", []string{
+			"-> Project: id | 1 | 0 | 0",
+			"    -> Filter: (total > 20) | 1 | 0 | 0",
+			`        -> Index range orders: ZRANGEBYSCORE idx:order:total "(20" "+inf", HGETALL per key | 1 | 2 | 2`,
+			"total | NULL | 2 | 2",
+		}},
+	})
+}
+
+func TestLoadTablesErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		msg    string
+	}{
+		{`{"a": "a:{id}", "b": "b:*"}`, "must hold {id} once"},
+		{`{"a": "a:{id}", "b": {"columns": ["x"]}}`, "table b has no key pattern"},
+		{`{"a": {"pattern": "a:{id}", "size": 3}}`, `table a: json: unknown field "size"`},
+		{`{"a": {"pattern": "a:{id}", "indexes": [{"column": "x", "key": "idx", "kind": "hash"}]}}`, `index idx of table a has unknown kind "hash"`},
+		{`{"a": {"pattern": "a:{id}", "indexes": [{"column": "x"}]}}`, "index of table a needs a column and a key"},
+		{`["a:{id}"]`, "cannot unmarshal array"},
+	}
+	for _, tt := range tests {
+		eng, _ := newTestEngine(t)
+		path := writeFile(t, tt.config)
+		err := eng.LoadTables(path)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) || !strings.HasPrefix(err.Error(), path+": ") {
+			t.Errorf("LoadTables(%s): error = %v, want it to mention %q", tt.config, err, tt.msg)
+		}
+		// no table is registered unless the whole file is valid
+		if _, ok := eng.tables["a"]; ok {
+			t.Errorf("LoadTables(%s) registered table a", tt.config)
+		}
+	}
+
+	eng, _ := newTestEngine(t)
+	if err := eng.LoadTables(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("LoadTables of a missing file: error = %v", err)
+	}
+}
+
+// writeFile writes data to a new file and returns its path
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tables.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTableKeys(t *testing.T) {
+	table := &Table{Name: "t", Pattern: "a:{id}:b"}
+	if err := table.init(); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.key("7"); got != "a:7:b" {
+		t.Errorf("key(7) = %s, want a:7:b", got)
+	}
+	for _, tt := range []struct {
+		key string
+		id  string
+		ok  bool
+	}{
+		{"a:7:b", "7", true},
+		{"a::b", "", true},
+		{"a:7:c", "", false},
+		{"a:b", "", false},
+	} {
+		if id, ok := table.id(tt.key); ok != tt.ok || ok && id != tt.id {
+			t.Errorf("id(%s) = %q, %v, want %q, %v", tt.key, id, ok, tt.id, tt.ok)
+		}
+	}
+	if got := table.match("1"); got != "a:1*:b" {
+		t.Errorf("match(1) = %s, want a:1*:b", got)
+	}
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-parse/parser"
+)
+
+// order returns -1, 0 or +1 as left sorts before, equal to or after right,
+// and false when the two values can't be compared. The type of the typed
+// (non-string) side decides how a hash string is read:
+//
+//   - DATE/TIMESTAMP: the string must hold a date or timestamp
+//   - boolean: the string must be 1, 0, true or false
+//   - number: the string must hold a number; integers compare exactly
+//   - string with string: byte-wise comparison, or in the MySQL dialect
+//     ignoring case and trailing spaces
+func (d Dialect) order(left, right interface{}) (int, bool) {
+	switch {
+	case isTime(left) || isTime(right):
+		lt, lok := toTime(left)
+		rt, rok := toTime(right)
+		if !lok || !rok {
+			return 0, false
+		}
+		return lt.Compare(rt), true
+	case isBool(left) || isBool(right):
+		lb, lok := toBool(left)
+		rb, rok := toBool(right)
+		if !lok || !rok {
+			return 0, false
+		}
+		return compareInts(boolInt(lb), boolInt(rb)), true
+	case isNumber(left) || isNumber(right):
+		return compareNumbers(left, right)
+	}
+	return strings.Compare(d.collate(toString(left)), d.collate(toString(right))), true
+}
+
+// compareNumbers compares two values holding numbers, exactly when both are integers
+func compareNumbers(left, right interface{}) (int, bool) {
+	li, lInt := toInt(left)
+	ri, rInt := toInt(right)
+	if lInt && rInt {
+		return compareInts(li, ri), true
+	}
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok || math.IsNaN(lf) || math.IsNaN(rf) {
+		return 0, false
+	}
+	switch {
+	case lf < rf:
+		return -1, true
+	case lf > rf:
+		return 1, true
+	}
+	return 0, true
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func isBool(v interface{}) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+func isTime(v interface{}) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+// toInt converts integers and strings holding integers to int64
+func toInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// toFloat converts numbers and strings holding numbers to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		return float64(boolInt(v)), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toBool converts booleans, numbers and the strings accepted by
+// strconv.ParseBool (1, 0, true, false, ...)
+func toBool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
+// toTime converts times and strings holding a date or timestamp
+func toTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := parser.ParseTime(v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// toString renders a non-NULL value the way it is stored in a hash
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format(parser.DateLayout)
+		}
+		return v.Format(parser.TimestampLayout)
+	}
+	return fmt.Sprint(v)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
+
+	"db-parse/engine"
+	"db-parse/parser"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -43,30 +45,44 @@ func main() {
 // handleSQLQuery parses a basic SQL query and retrieves data from KeyDB
 func handleSQLQuery(query string) (string, error) {
 	// Example: "SELECT value FROM keydb WHERE key='user:1001'"
-	query = strings.TrimSpace(query)
-	if strings.HasPrefix(strings.ToUpper(query), "SELECT") {
-		// Extract the key from the query
-		start := strings.Index(query, "key='") + len("key='")
-		end := strings.Index(query[start:], "'") + start
-
-		if start == -1 || end == -1 || end <= start {
-			return "", fmt.Errorf("invalid SQL query")
-		}
+	stmt, err := parser.ParseSelect(query)
+	if err != nil {
+		return "", err
+	}
 
-		// Extracted key
-		key := query[start:end]
+	// Extract the key from the WHERE clause
+	key, ok := findKey(stmt.Where)
+	if !ok {
+		return "", fmt.Errorf("WHERE has no key='...' condition")
+	}
 
-		// Retrieve value from KeyDB using the key
-		val, err := rdb.Get(ctx, key).Result()
-		if err != nil {
-			if err == redis.Nil {
-				return "", fmt.Errorf("key not found")
-			}
-			return "", err
+	// Retrieve value from KeyDB using the key
+	val, err := rdb.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", fmt.Errorf("key %s not found", key)
 		}
-
-		return val, nil
+		return "", &engine.BackendError{Err: err}
 	}
 
-	return "", fmt.Errorf("unsupported query")
+	return val, nil
+}
+
+// findKey looks for a key='...' condition in the WHERE clause
+func findKey(where parser.Expr) (string, bool) {
+	var key string
+	var found bool
+	parser.Walk(where, func(e parser.Expr) bool {
+		b, ok := e.(*parser.BinaryExpr)
+		if !ok || b.Op != "=" {
+			return !found
+		}
+		col, ok := b.Left.(*parser.ColumnRef)
+		lit, isLit := b.Right.(*parser.Literal)
+		if ok && isLit && col.Name == "key" {
+			key, found = fmt.Sprint(lit.Value), true
+		}
+		return false
+	})
+	return key, found
 }
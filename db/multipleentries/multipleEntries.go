@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"db-parse/engine"
+
 	"github.com/go-redis/redis/v8"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
@@ -25,6 +27,9 @@ var (
 	})
 
 	countries = []string{"India", "USA", "Canada"} // List of countries to choose from
+
+	// SQL engine over KeyDB, built once so that it keeps the queries it has parsed
+	eng = engine.New(rdb)
 )
 
 func main() {
@@ -60,11 +65,15 @@ func main() {
 		fmt.Printf("Inserted %d user profiles in %v\n", numUsers, durationInsert)
 
 		// Example SQL-like query to retrieve data with age > 25
-		sqlQuery := "SELECT email FROM keydb WHERE age > 25 AND country='India'"
+		sqlQuery := "SELECT email FROM users WHERE age > 25 AND country='India'"
+
+		if err := addUsersTable(numUsers); err != nil {
+			log.Fatalf("Error adding table: %v\n", err)
+		}
 
 		// Measure query time
 		startQuery := time.Now()
-		result, err := handleSQLQuery(sqlQuery, numUsers)
+		result, err := handleSQLQuery(sqlQuery)
 		if err != nil {
 			log.Fatalf("Error handling SQL query: %v\n", err)
 		}
@@ -81,67 +90,29 @@ func main() {
 	}
 }
 
-func extractFields(query string) []string {
-	selectStart := len("SELECT ")
-	selectEnd := strings.Index(query, " FROM ")
-	fields := strings.TrimSpace(query[selectStart:selectEnd])
-
-	if fields == "*" {
-		return []string{"name", "email", "age", "country"} // Return all fields you expect
+// addUsersTable maps the users table to the numUsers users written so far
+func addUsersTable(numUsers int) error {
+	err := eng.AddTable(&engine.Table{
+		Name:    "users",
+		Pattern: "user:{id}", // Generating user keys dynamically
+		Count:   numUsers,
+		Columns: []string{"name", "email", "age", "country"},
+	})
+	if err != nil {
+		return fmt.Errorf("adding table users: %w", err)
 	}
-
-	return strings.Split(fields, ",")
+	return nil
 }
 
-func handleSQLQuery(query string, numUsers int) (string, error) {
+func handleSQLQuery(query string) (string, error) {
 	query = strings.TrimSpace(query)
 	fmt.Printf("Received SQL query: %s\n", query)
 
-	if strings.HasPrefix(strings.ToUpper(query), "SELECT") {
-		// Extract any additional conditions (e.g., WHERE clauses)
-		whereStart := strings.Index(query, "WHERE")
-		var conditions map[string]interface{}
-		if whereStart != -1 {
-			conditions = parseWhereClause(query[whereStart:])
-		}
-
-		// Prepare to retrieve data
-		var results []map[string]string
-		keys := make([]string, numUsers)
-		for i := 1; i <= numUsers; i++ {
-			keys[i-1] = fmt.Sprintf("user:%d", i) // Generating user keys dynamically
-		}
-
-		for _, key := range keys {
-			// Check conditions
-			if len(conditions) > 0 {
-				if !checkConditions(ctx, key, conditions) {
-					continue // Skip this key if conditions are not met
-				}
-			}
-
-			// Retrieve requested fields from KeyDB
-			fields := extractFields(query)
-			result := make(map[string]string)
-			for _, field := range fields {
-				val, err := rdb.HGet(ctx, key, field).Result()
-				if err != nil && err != redis.Nil {
-					return "", err
-				}
-				if err == redis.Nil {
-					continue // Field not found, skip it
-				}
-				result[field] = val
-			}
-
-			// Log the result from KeyDB
-			results = append(results, result)
-		}
-
-		return fmt.Sprintf("%v", results), nil
+	result, err := eng.Query(ctx, query)
+	if err != nil {
+		return "", err
 	}
-
-	return "", fmt.Errorf("unsupported query")
+	return result.String(), nil
 }
 
 // Plot the graph using gonum/plot
@@ -195,75 +166,3 @@ func plotGraph(numUsers, insertTimes, queryTimes []float64) error {
 	fmt.Println("Graph saved as times_vs_users.png")
 	return nil
 }
-
-// extractFields extracts fields to select from the SQL query
-//func extractFields(query string) []string {
-//	selectStart := len("SELECT ")
-//	selectEnd := strings.Index(query, " FROM ")
-//	fields := strings.Split(strings.TrimSpace(query[selectStart:selectEnd]), ",")
-//	for i := range fields {
-//		fields[i] = strings.TrimSpace(fields[i])
-//	}
-//	return fields
-//}
-
-// checkConditions checks if the conditions are met for the given key
-func checkConditions(ctx context.Context, key string, conditions map[string]interface{}) bool {
-	for field, expectedVal := range conditions {
-		actualVal, err := rdb.HGet(ctx, key, field).Result()
-		if err != nil {
-			return false // Field not found or error occurred
-		}
-
-		// Special handling for numeric comparisons (e.g., age > 25)
-		switch expectedVal := expectedVal.(type) {
-		case string:
-			if actualVal != expectedVal {
-				return false
-			}
-		case int:
-			actualInt, err := strconv.Atoi(actualVal)
-			if err != nil {
-				return false
-			}
-			if actualInt <= expectedVal { // If the age is less than or equal to the condition, skip this entry
-				return false
-			}
-		}
-	}
-	return true // All conditions met
-}
-
-// parseWhereClause parses the WHERE clause from the SQL-like query, supporting basic comparisons
-func parseWhereClause(whereClause string) map[string]interface{} {
-	conditions := make(map[string]interface{})
-
-	whereClause = strings.TrimSpace(strings.TrimPrefix(whereClause, "WHERE"))
-	conditionsList := strings.Split(whereClause, "AND")
-
-	for _, condition := range conditionsList {
-		condition = strings.TrimSpace(condition)
-
-		// Handle greater-than conditions (e.g., age > 25)
-		if strings.Contains(condition, ">") {
-			parts := strings.Split(condition, ">")
-			if len(parts) == 2 {
-				field := strings.TrimSpace(parts[0])
-				value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-				if err == nil {
-					conditions[field] = value
-				}
-			}
-		} else {
-			// Handle equality conditions (e.g., country='USA')
-			parts := strings.Split(condition, "=")
-			if len(parts) == 2 {
-				field := strings.TrimSpace(strings.Trim(parts[0], "'"))
-				value := strings.TrimSpace(strings.Trim(parts[1], "'"))
-				conditions[field] = value
-			}
-		}
-	}
-
-	return conditions
-}
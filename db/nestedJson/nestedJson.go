@@ -10,6 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"db-parse/engine"
+
 	"github.com/go-redis/redis/v8"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
@@ -26,6 +28,9 @@ var (
 	})
 
 	countries = []string{"India", "USA", "Canada"} // List of countries to choose from
+
+	// SQL engine over KeyDB, built once so that it keeps the queries it has parsed
+	eng = engine.New(rdb)
 )
 
 func main() {
@@ -70,11 +75,15 @@ func main() {
 		fmt.Printf("Inserted %d user profiles in %v\n", numUsers, durationInsert)
 
 		// Example SQL-like query to retrieve data with age > 25
-		sqlQuery := "SELECT email, address.city FROM keydb WHERE age > 25 AND country='India'"
+		sqlQuery := "SELECT email, address.city FROM users WHERE age > 25 AND country='India'"
+
+		if err := addUsersTable(numUsers); err != nil {
+			log.Fatalf("Error adding table: %v\n", err)
+		}
 
 		// Measure query time
 		startQuery := time.Now()
-		result, err := handleSQLQuery(sqlQuery, numUsers)
+		result, err := handleSQLQuery(sqlQuery)
 		if err != nil {
 			log.Fatalf("Error handling SQL query: %v\n", err)
 		}
@@ -82,6 +91,15 @@ func main() {
 		queryTimes = append(queryTimes, durationQuery)
 		fmt.Printf("Query time for %d users: %v\n", numUsers, durationQuery)
 		fmt.Printf("result: %v\n", result)
+
+		// Run it again with EXPLAIN ANALYZE to see which step grows with the number of users
+		analysis, err := analyzeSQLQuery(sqlQuery)
+		if err != nil {
+			log.Fatalf("Error analyzing SQL query: %v\n", err)
+		}
+		commands, roundTrips, bytes := analysis.Analysis.Total()
+		fmt.Printf("%v\n", analysis)
+		fmt.Printf("KeyDB traffic for %d users: %d commands, %d round trips, %d bytes\n", numUsers, commands, roundTrips, bytes)
 	}
 
 	// Plot the graph
@@ -91,75 +109,35 @@ func main() {
 	}
 }
 
-func extractFields(query string) []string {
-	selectStart := len("SELECT ")
-	selectEnd := strings.Index(query, " FROM ")
-	fields := strings.TrimSpace(query[selectStart:selectEnd])
-
-	// Split by commas and handle nested fields
-	return strings.Split(fields, ",")
-}
-
-func handleSQLQuery(query string, numUsers int) (string, error) {
+func handleSQLQuery(query string) (string, error) {
 	query = strings.TrimSpace(query)
 	fmt.Printf("Received SQL query: %s\n", query)
 
-	if strings.HasPrefix(strings.ToUpper(query), "SELECT") {
-		// Extract any additional conditions (e.g., WHERE clauses)
-		whereStart := strings.Index(query, "WHERE")
-		var conditions map[string]interface{}
-		if whereStart != -1 {
-			conditions = parseWhereClause(query[whereStart:])
-		}
-
-		// Prepare to retrieve data
-		var results []map[string]string
-		keys := make([]string, numUsers)
-		for i := 1; i <= numUsers; i++ {
-			keys[i-1] = fmt.Sprintf("user:%d", i) // Generating user keys dynamically
-		}
-
-		for _, key := range keys {
-			// Check conditions
-			if len(conditions) > 0 {
-				if !checkConditions(ctx, key, conditions) {
-					continue // Skip this key if conditions are not met
-				}
-			}
-
-			// Retrieve requested fields from KeyDB
-			fields := extractFields(query)
-			result := make(map[string]string)
-			for _, field := range fields {
-				val, err := rdb.HGet(ctx, key, field).Result()
-				if err != nil && err != redis.Nil {
-					return "", err
-				}
-				if err == redis.Nil {
-					// Handle nested fields
-					if strings.Contains(field, ".") {
-						nestedField := strings.Split(field, ".")[1]
-						addressJSON, err := rdb.HGet(ctx, key, "address").Result()
-						if err == nil {
-							var addressData map[string]string
-							json.Unmarshal([]byte(addressJSON), &addressData)
-							val = addressData[nestedField]
-						}
-					} else {
-						continue // Field not found, skip it
-					}
-				}
-				result[field] = val
-			}
+	result, err := eng.Query(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
 
-			// Log the result from KeyDB
-			results = append(results, result)
-		}
+// analyzeSQLQuery runs the query with EXPLAIN ANALYZE, which reports the
+// rows, time and KeyDB commands of each step
+func analyzeSQLQuery(query string) (*engine.Result, error) {
+	return eng.Query(ctx, "EXPLAIN ANALYZE "+strings.TrimSpace(query))
+}
 
-		return fmt.Sprintf("%v", results), nil
+// addUsersTable maps the users table to the numUsers users written so far
+func addUsersTable(numUsers int) error {
+	err := eng.AddTable(&engine.Table{
+		Name:    "users",
+		Pattern: "user:{id}", // Generating user keys dynamically
+		Count:   numUsers,
+		Columns: []string{"name", "email", "age", "country", "address"},
+	})
+	if err != nil {
+		return fmt.Errorf("adding table users: %w", err)
 	}
-
-	return "", fmt.Errorf("unsupported query")
+	return nil
 }
 
 func plotGraph(numUsers, insertTimes, queryTimes []float64) error {
@@ -212,73 +190,3 @@ func plotGraph(numUsers, insertTimes, queryTimes []float64) error {
 	fmt.Println("Graph saved as times_vs_users.png")
 	return nil
 }
-
-func checkConditions(ctx context.Context, key string, conditions map[string]interface{}) bool {
-	for field, expectedVal := range conditions {
-		actualVal, err := rdb.HGet(ctx, key, field).Result()
-		if err != nil {
-			return false // Field not found or error occurred
-		}
-
-		// Check for nested fields
-		if strings.Contains(field, ".") {
-			nestedField := strings.Split(field, ".")[1]
-			addressJSON, err := rdb.HGet(ctx, key, "address").Result()
-			if err == nil {
-				var addressData map[string]string
-				json.Unmarshal([]byte(addressJSON), &addressData)
-				actualVal = addressData[nestedField]
-			}
-		}
-
-		// Special handling for numeric comparisons (e.g., age > 25)
-		switch expectedVal := expectedVal.(type) {
-		case string:
-			if actualVal != expectedVal {
-				return false
-			}
-		case int:
-			actualInt, err := strconv.Atoi(actualVal)
-			if err != nil {
-				return false
-			}
-			if actualInt <= expectedVal { // If the age is less than or equal to the condition, skip this entry
-				return false
-			}
-		}
-	}
-	return true // All conditions met
-}
-
-func parseWhereClause(whereClause string) map[string]interface{} {
-	conditions := make(map[string]interface{})
-
-	whereClause = strings.TrimSpace(strings.TrimPrefix(whereClause, "WHERE"))
-	conditionsList := strings.Split(whereClause, "AND")
-
-	for _, condition := range conditionsList {
-		condition = strings.TrimSpace(condition)
-
-		// Handle greater-than conditions (e.g., age > 25)
-		if strings.Contains(condition, ">") {
-			parts := strings.Split(condition, ">")
-			if len(parts) == 2 {
-				field := strings.TrimSpace(parts[0])
-				value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-				if err == nil {
-					conditions[field] = value
-				}
-			}
-		} else {
-			// Handle equality conditions (e.g., country='USA')
-			parts := strings.Split(condition, "=")
-			if len(parts) == 2 {
-				field := strings.TrimSpace(strings.Trim(parts[0], "'"))
-				value := strings.TrimSpace(strings.Trim(parts[1], "'"))
-				conditions[field] = value
-			}
-		}
-	}
-
-	return conditions
-}
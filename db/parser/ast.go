@@ -0,0 +1,716 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Statement is a parsed top-level SQL statement
+type Statement interface {
+	statement()
+	String() string
+}
+
+// Expr is a node of an expression tree
+type Expr interface {
+	expr()
+	String() string
+}
+
+// SelectStmt is a parsed SELECT query. From is nil when the query has no
+// FROM clause, as in "SELECT NOW()".
+type SelectStmt struct {
+	With      []*CTE
+	Recursive bool // WITH RECURSIVE
+	Distinct  bool
+	Fields    []*SelectField
+	From      *TableRef
+	Joins     []*Join
+	Where     Expr
+	GroupBy   []Expr
+	Having    Expr
+	OrderBy   []*OrderItem
+	Limit     Expr
+	Offset    Expr
+}
+
+// SetOpStmt combines the rows of two queries with UNION, INTERSECT or
+// EXCEPT. ORDER BY and LIMIT apply to the combined rows.
+type SetOpStmt struct {
+	With      []*CTE
+	Recursive bool
+	Op        string // UNION, INTERSECT or EXCEPT
+	All       bool   // keep duplicate rows
+	Left      Statement
+	Right     Statement
+	OrderBy   []*OrderItem
+	Limit     Expr
+	Offset    Expr
+}
+
+// ExplainStmt is "EXPLAIN query", which describes how the query would run
+// instead of running it, or "EXPLAIN ANALYZE query", which runs it and
+// reports what each step did
+type ExplainStmt struct {
+	Stmt    Statement
+	Analyze bool
+}
+
+// ShowStmt is a MySQL SHOW statement: "SHOW [FULL] TABLES", "SHOW
+// DATABASES", "SHOW [FULL] COLUMNS FROM table", "SHOW INDEX FROM table",
+// "SHOW VARIABLES" or "SHOW WARNINGS", optionally followed by LIKE 'pattern'.
+// "DESCRIBE table" is parsed as SHOW COLUMNS.
+type ShowStmt struct {
+	What  string // TABLES, DATABASES, COLUMNS, INDEX, VARIABLES or WARNINGS
+	Full  bool
+	Table string // the table of COLUMNS and INDEX
+	Like  Expr   // the LIKE pattern, a string *Literal or a *Param, nil for none
+}
+
+// SetStmt is a MySQL SET statement: "SET NAMES charset [COLLATE collation]"
+// or "SET [GLOBAL | SESSION] variable = value, ..."
+type SetStmt struct {
+	Names   string // the character set of SET NAMES
+	Collate string
+	Vars    []*SetVar
+}
+
+// SetVar is a "variable = value" assignment of a SET statement
+type SetVar struct {
+	Scope string // GLOBAL, SESSION or ""
+	Name  string
+	Value Expr
+}
+
+// CTE is a common table expression, "name [(columns)] AS (SELECT ...)".
+// Select may be followed by a second query, Union, combined with it with
+// UNION [ALL]; in a WITH RECURSIVE that query is the recursive member, which
+// reads the rows the CTE produced in the previous step.
+type CTE struct {
+	Name     string
+	Columns  []string
+	Select   *SelectStmt
+	Union    *SelectStmt
+	UnionAll bool
+}
+
+// SelectField is one entry of the projection list
+type SelectField struct {
+	Expr  Expr
+	Alias string
+}
+
+// TableRef names a table in the FROM or JOIN clause
+type TableRef struct {
+	Name  string
+	Alias string
+}
+
+// Join is a JOIN clause and its ON condition
+type Join struct {
+	Table *TableRef
+	On    Expr
+}
+
+// Placement of NULLs in an ORDER BY item
+const (
+	NullsDefault = iota // first when ascending, last when descending
+	NullsFirst
+	NullsLast
+)
+
+// OrderItem is one sort key of an ORDER BY clause
+type OrderItem struct {
+	Expr  Expr
+	Desc  bool
+	Nulls int
+}
+
+// ColumnRef references a column, optionally qualified by a table name or alias
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+// StarExpr is the * of "SELECT *" or "SELECT t.*"
+type StarExpr struct {
+	Table string
+}
+
+// Literal is a constant value: a string, int64, float64, bool, time.Time for
+// DATE and TIMESTAMP literals, or nil for NULL
+type Literal struct {
+	Value interface{}
+}
+
+// Param is a placeholder for a value bound when a prepared statement runs:
+// "?", numbered in order of appearance, or "$n"
+type Param struct {
+	Index int // from 1
+}
+
+// VarRef reads a system variable of the server: "@@name", or
+// "@@session.name" and "@@global.name" with a scope
+type VarRef struct {
+	Scope string // GLOBAL or SESSION, upper-cased, if written
+	Name  string
+}
+
+// UnaryExpr applies a prefix operator: NOT, or the sign - or +
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+// BinaryExpr applies a binary operator such as "=", ">", "AND", "OR", the
+// arithmetic "+", "-", "*", "/" and "%", or the string concatenation "||"
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// InExpr is "expr [NOT] IN (list)" or "expr [NOT] IN (SELECT ...)"
+type InExpr struct {
+	Expr     Expr
+	List     []Expr
+	Subquery *SubqueryExpr
+	Not      bool
+}
+
+// BetweenExpr is "expr [NOT] BETWEEN low AND high"
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// LikeExpr is a pattern match: "expr [NOT] LIKE pattern [ESCAPE char]", its
+// case-insensitive ILIKE form, or "expr [NOT] REGEXP pattern"
+type LikeExpr struct {
+	Op      string // LIKE, ILIKE or REGEXP
+	Expr    Expr
+	Pattern Expr
+	Escape  Expr
+	Not     bool
+}
+
+// IsNullExpr is "expr IS [NOT] NULL"
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+// FuncCall is a call of a named function such as COALESCE(a, b). COUNT(*)
+// has a single StarExpr argument.
+type FuncCall struct {
+	Name     string // upper-cased
+	Args     []Expr
+	Distinct bool // COUNT(DISTINCT x)
+}
+
+// CaseExpr is "CASE WHEN cond THEN result ... [ELSE result] END", or with an
+// operand, "CASE operand WHEN value THEN result ... END", where each WHEN
+// compares its value with the operand
+type CaseExpr struct {
+	Operand Expr
+	Whens   []*When
+	Else    Expr
+}
+
+// When is a "WHEN cond THEN result" branch of a CASE expression
+type When struct {
+	Cond   Expr
+	Result Expr
+}
+
+// SubqueryExpr is a parenthesized SELECT used as a value. Expression walks
+// don't enter it: its columns belong to its own FROM clause, except those
+// qualified with the name of a table of an enclosing query.
+type SubqueryExpr struct {
+	Select *SelectStmt
+}
+
+// ExistsExpr is "EXISTS (SELECT ...)"
+type ExistsExpr struct {
+	Subquery *SubqueryExpr
+}
+
+func (*SelectStmt) statement()  {}
+func (*SetOpStmt) statement()   {}
+func (*ExplainStmt) statement() {}
+func (*ShowStmt) statement()    {}
+func (*SetStmt) statement()     {}
+
+func (*ColumnRef) expr()    {}
+func (*StarExpr) expr()     {}
+func (*Literal) expr()      {}
+func (*Param) expr()        {}
+func (*VarRef) expr()       {}
+func (*UnaryExpr) expr()    {}
+func (*BinaryExpr) expr()   {}
+func (*InExpr) expr()       {}
+func (*BetweenExpr) expr()  {}
+func (*LikeExpr) expr()     {}
+func (*IsNullExpr) expr()   {}
+func (*FuncCall) expr()     {}
+func (*CaseExpr) expr()     {}
+func (*SubqueryExpr) expr() {}
+func (*ExistsExpr) expr()   {}
+
+func (s *SelectStmt) String() string {
+	var sb strings.Builder
+	writeWith(&sb, s.With, s.Recursive)
+	sb.WriteString("SELECT ")
+	if s.Distinct {
+		sb.WriteString("DISTINCT ")
+	}
+	for i, f := range s.Fields {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(f.String())
+	}
+	if s.From != nil {
+		sb.WriteString(" FROM ")
+		sb.WriteString(s.From.String())
+	}
+	for _, j := range s.Joins {
+		sb.WriteString(" JOIN ")
+		sb.WriteString(j.Table.String())
+		sb.WriteString(" ON ")
+		sb.WriteString(j.On.String())
+	}
+	if s.Where != nil {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(s.Where.String())
+	}
+	if len(s.GroupBy) > 0 {
+		sb.WriteString(" GROUP BY ")
+		for i, expr := range s.GroupBy {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(expr.String())
+		}
+	}
+	if s.Having != nil {
+		sb.WriteString(" HAVING ")
+		sb.WriteString(s.Having.String())
+	}
+	writeOrderLimit(&sb, s.OrderBy, s.Limit, s.Offset)
+	return sb.String()
+}
+
+func (o *OrderItem) String() string {
+	s := o.Expr.String()
+	if o.Desc {
+		s += " DESC"
+	}
+	switch o.Nulls {
+	case NullsFirst:
+		s += " NULLS FIRST"
+	case NullsLast:
+		s += " NULLS LAST"
+	}
+	return s
+}
+
+func (f *SelectField) String() string {
+	if f.Alias != "" {
+		return f.Expr.String() + " AS " + QuoteIdent(f.Alias)
+	}
+	return f.Expr.String()
+}
+
+// Name returns the output column name of the field: its alias, or its
+// expression without the outer parentheses of an operation such as "age + 1"
+func (f *SelectField) Name() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	switch e := f.Expr.(type) {
+	case *BinaryExpr, *UnaryExpr:
+		s := e.String()
+		return s[1 : len(s)-1]
+	}
+	return f.Expr.String()
+}
+
+func (s *SetOpStmt) String() string {
+	var sb strings.Builder
+	writeWith(&sb, s.With, s.Recursive)
+	sb.WriteString(operand(s.Left))
+	sb.WriteString(" " + s.Op + " ")
+	if s.All {
+		sb.WriteString("ALL ")
+	}
+	sb.WriteString(operand(s.Right))
+	writeOrderLimit(&sb, s.OrderBy, s.Limit, s.Offset)
+	return sb.String()
+}
+
+func (s *ExplainStmt) String() string {
+	if s.Analyze {
+		return "EXPLAIN ANALYZE " + s.Stmt.String()
+	}
+	return "EXPLAIN " + s.Stmt.String()
+}
+
+func (s *ShowStmt) String() string {
+	var sb strings.Builder
+	sb.WriteString("SHOW ")
+	if s.Full {
+		sb.WriteString("FULL ")
+	}
+	sb.WriteString(s.What)
+	if s.Table != "" {
+		sb.WriteString(" FROM " + QuoteIdent(s.Table))
+	}
+	if s.Like != nil {
+		sb.WriteString(" LIKE " + s.Like.String())
+	}
+	return sb.String()
+}
+
+func (s *SetStmt) String() string {
+	if s.Names != "" {
+		str := "SET NAMES " + QuoteIdent(s.Names)
+		if s.Collate != "" {
+			str += " COLLATE " + QuoteIdent(s.Collate)
+		}
+		return str
+	}
+	vars := make([]string, len(s.Vars))
+	for i, v := range s.Vars {
+		vars[i] = v.String()
+	}
+	return "SET " + strings.Join(vars, ", ")
+}
+
+func (v *SetVar) String() string {
+	s := QuoteIdent(v.Name) + " = " + v.Value.String()
+	if v.Scope != "" {
+		s = v.Scope + " " + s
+	}
+	return s
+}
+
+// operand renders an operand of a set operation, in parentheses when it is
+// itself combined or has clauses that would otherwise apply to the whole
+func operand(stmt Statement) string {
+	switch s := stmt.(type) {
+	case *SetOpStmt:
+		return "(" + s.String() + ")"
+	case *SelectStmt:
+		if len(s.With) > 0 || len(s.OrderBy) > 0 || s.Limit != nil {
+			return "(" + s.String() + ")"
+		}
+	}
+	return stmt.String()
+}
+
+func writeWith(sb *strings.Builder, ctes []*CTE, recursive bool) {
+	if len(ctes) == 0 {
+		return
+	}
+	sb.WriteString("WITH ")
+	if recursive {
+		sb.WriteString("RECURSIVE ")
+	}
+	for i, cte := range ctes {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(cte.String())
+	}
+	sb.WriteString(" ")
+}
+
+func writeOrderLimit(sb *strings.Builder, orderBy []*OrderItem, limit, offset Expr) {
+	if len(orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		for i, item := range orderBy {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(item.String())
+		}
+	}
+	if limit != nil {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(limit.String())
+	}
+	if offset != nil {
+		sb.WriteString(" OFFSET ")
+		sb.WriteString(offset.String())
+	}
+}
+
+func (c *CTE) String() string {
+	var sb strings.Builder
+	sb.WriteString(QuoteIdent(c.Name))
+	if len(c.Columns) > 0 {
+		cols := make([]string, len(c.Columns))
+		for i, col := range c.Columns {
+			cols[i] = QuoteIdent(col)
+		}
+		sb.WriteString(" (" + strings.Join(cols, ", ") + ")")
+	}
+	sb.WriteString(" AS (" + c.Select.String())
+	if c.Union != nil {
+		sb.WriteString(" UNION ")
+		if c.UnionAll {
+			sb.WriteString("ALL ")
+		}
+		sb.WriteString(c.Union.String())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (t *TableRef) String() string {
+	if t.Alias != "" {
+		return QuoteIdent(t.Name) + " AS " + QuoteIdent(t.Alias)
+	}
+	return QuoteIdent(t.Name)
+}
+
+// RefName returns the name the table is referenced by in column qualifiers
+func (t *TableRef) RefName() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Name
+}
+
+func (c *ColumnRef) String() string {
+	if c.Table != "" {
+		return QuoteIdent(c.Table) + "." + QuoteIdent(c.Name)
+	}
+	return QuoteIdent(c.Name)
+}
+
+func (s *StarExpr) String() string {
+	if s.Table != "" {
+		return QuoteIdent(s.Table) + ".*"
+	}
+	return "*"
+}
+
+func (l *Literal) String() string {
+	switch v := l.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return "DATE '" + v.Format(DateLayout) + "'"
+		}
+		return "TIMESTAMP '" + v.Format(TimestampLayout) + "'"
+	}
+	return fmt.Sprintf("%v", l.Value)
+}
+
+func (p *Param) String() string {
+	return fmt.Sprintf("$%d", p.Index)
+}
+
+func (v *VarRef) String() string {
+	if v.Scope != "" {
+		return "@@" + strings.ToLower(v.Scope) + "." + v.Name
+	}
+	return "@@" + v.Name
+}
+
+func (u *UnaryExpr) String() string {
+	if u.Op == "-" || u.Op == "+" {
+		return fmt.Sprintf("(%s%s)", u.Op, u.Expr)
+	}
+	return fmt.Sprintf("(%s %s)", u.Op, u.Expr)
+}
+
+func (b *BinaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.Left, b.Op, b.Right)
+}
+
+func (e *InExpr) String() string {
+	if e.Subquery != nil {
+		return fmt.Sprintf("(%s %sIN %s)", e.Expr, not(e.Not), e.Subquery)
+	}
+	items := make([]string, len(e.List))
+	for i, item := range e.List {
+		items[i] = item.String()
+	}
+	return fmt.Sprintf("(%s %sIN (%s))", e.Expr, not(e.Not), strings.Join(items, ", "))
+}
+
+func (e *BetweenExpr) String() string {
+	return fmt.Sprintf("(%s %sBETWEEN %s AND %s)", e.Expr, not(e.Not), e.Low, e.High)
+}
+
+func (e *LikeExpr) String() string {
+	if e.Escape != nil {
+		return fmt.Sprintf("(%s %s%s %s ESCAPE %s)", e.Expr, not(e.Not), e.Op, e.Pattern, e.Escape)
+	}
+	return fmt.Sprintf("(%s %s%s %s)", e.Expr, not(e.Not), e.Op, e.Pattern)
+}
+
+func (e *IsNullExpr) String() string {
+	return fmt.Sprintf("(%s IS %sNULL)", e.Expr, not(e.Not))
+}
+
+func (f *FuncCall) String() string {
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = arg.String()
+	}
+	if f.Distinct {
+		return fmt.Sprintf("%s(DISTINCT %s)", f.Name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%s(%s)", f.Name, strings.Join(args, ", "))
+}
+
+func (c *CaseExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString("CASE")
+	if c.Operand != nil {
+		sb.WriteString(" " + c.Operand.String())
+	}
+	for _, w := range c.Whens {
+		fmt.Fprintf(&sb, " WHEN %s THEN %s", w.Cond, w.Result)
+	}
+	if c.Else != nil {
+		sb.WriteString(" ELSE " + c.Else.String())
+	}
+	sb.WriteString(" END")
+	return sb.String()
+}
+
+func (s *SubqueryExpr) String() string {
+	return "(" + s.Select.String() + ")"
+}
+
+func (e *ExistsExpr) String() string {
+	return "EXISTS " + e.Subquery.String()
+}
+
+func not(negated bool) string {
+	if negated {
+		return "NOT "
+	}
+	return ""
+}
+
+// Walk calls fn for expr and each of its sub-expressions, depth first.
+// Children are skipped when fn returns false. Subqueries are visited but not
+// entered.
+func Walk(expr Expr, fn func(Expr) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+	switch e := expr.(type) {
+	case *UnaryExpr:
+		Walk(e.Expr, fn)
+	case *BinaryExpr:
+		Walk(e.Left, fn)
+		Walk(e.Right, fn)
+	case *InExpr:
+		Walk(e.Expr, fn)
+		for _, item := range e.List {
+			Walk(item, fn)
+		}
+		if e.Subquery != nil {
+			Walk(e.Subquery, fn)
+		}
+	case *ExistsExpr:
+		Walk(e.Subquery, fn)
+	case *BetweenExpr:
+		Walk(e.Expr, fn)
+		Walk(e.Low, fn)
+		Walk(e.High, fn)
+	case *LikeExpr:
+		Walk(e.Expr, fn)
+		Walk(e.Pattern, fn)
+		Walk(e.Escape, fn)
+	case *IsNullExpr:
+		Walk(e.Expr, fn)
+	case *FuncCall:
+		for _, arg := range e.Args {
+			Walk(arg, fn)
+		}
+	case *CaseExpr:
+		Walk(e.Operand, fn)
+		for _, w := range e.Whens {
+			Walk(w.Cond, fn)
+			Walk(w.Result, fn)
+		}
+		Walk(e.Else, fn)
+	}
+}
+
+// Rewrite returns a copy of expr where every sub-expression for which fn
+// returns a replacement is replaced, depth first. Nodes fn leaves alone (by
+// returning nil) are copied with their rewritten children. Subqueries are not
+// entered.
+func Rewrite(expr Expr, fn func(Expr) Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	if r := fn(expr); r != nil {
+		return r
+	}
+	switch e := expr.(type) {
+	case *UnaryExpr:
+		return &UnaryExpr{Op: e.Op, Expr: Rewrite(e.Expr, fn)}
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, Left: Rewrite(e.Left, fn), Right: Rewrite(e.Right, fn)}
+	case *InExpr:
+		out := &InExpr{Expr: Rewrite(e.Expr, fn), Subquery: e.Subquery, Not: e.Not}
+		for _, item := range e.List {
+			out.List = append(out.List, Rewrite(item, fn))
+		}
+		return out
+	case *BetweenExpr:
+		return &BetweenExpr{Expr: Rewrite(e.Expr, fn), Low: Rewrite(e.Low, fn), High: Rewrite(e.High, fn), Not: e.Not}
+	case *LikeExpr:
+		return &LikeExpr{Op: e.Op, Expr: Rewrite(e.Expr, fn), Pattern: Rewrite(e.Pattern, fn), Escape: Rewrite(e.Escape, fn), Not: e.Not}
+	case *IsNullExpr:
+		return &IsNullExpr{Expr: Rewrite(e.Expr, fn), Not: e.Not}
+	case *FuncCall:
+		out := &FuncCall{Name: e.Name, Distinct: e.Distinct}
+		for _, arg := range e.Args {
+			out.Args = append(out.Args, Rewrite(arg, fn))
+		}
+		return out
+	case *CaseExpr:
+		out := &CaseExpr{Operand: Rewrite(e.Operand, fn), Else: Rewrite(e.Else, fn)}
+		for _, w := range e.Whens {
+			out.Whens = append(out.Whens, &When{Cond: Rewrite(w.Cond, fn), Result: Rewrite(w.Result, fn)})
+		}
+		return out
+	}
+	return expr
+}
+
+// Columns returns the distinct columns referenced by expr, in order of appearance
+func Columns(expr Expr) []*ColumnRef {
+	var cols []*ColumnRef
+	seen := make(map[string]bool)
+	Walk(expr, func(e Expr) bool {
+		if c, ok := e.(*ColumnRef); ok && !seen[c.String()] {
+			seen[c.String()] = true
+			cols = append(cols, c)
+		}
+		return true
+	})
+	return cols
+}
@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError reports a query that isn't valid SQL, or uses syntax the parser
+// doesn't support, at the position of the offending token. Its MySQL error
+// code is 1064 (ER_PARSE_ERROR).
+type ParseError struct {
+	Pos      Pos
+	Msg      string   // what is wrong, when it isn't a missing token
+	Expected []string // the tokens that would have been accepted
+	Found    string   // the token found instead
+}
+
+func (e *ParseError) Error() string {
+	if e.Msg != "" {
+		return fmt.Sprintf("%s at %s", e.Msg, e.Pos)
+	}
+	return fmt.Sprintf("expected %s at %s, found %s", strings.Join(e.Expected, " or "), e.Pos, e.Found)
+}
+
+// Line returns the line of the error, from 1
+func (e *ParseError) Line() int {
+	return e.Pos.Line
+}
+
+// Column returns the column of the error in its line, from 1
+func (e *ParseError) Column() int {
+	return e.Pos.Column
+}
+
+// Code returns the MySQL error code of parse errors
+func (e *ParseError) Code() int {
+	return 1064
+}
+
+// SQLState returns the SQLSTATE of parse errors
+func (e *ParseError) SQLState() string {
+	return "42000"
+}
+
+// errorAt returns a ParseError at pos with a formatted message
+func errorAt(pos Pos, format string, args ...interface{}) *ParseError {
+	return &ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
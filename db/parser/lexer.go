@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Lexer splits a query into tokens
+type Lexer struct {
+	input  string
+	offset int
+	line   int
+	column int
+	opts   Options
+}
+
+// NewLexer returns a lexer following standard SQL, positioned at the start
+// of input
+func NewLexer(input string) *Lexer {
+	return Options{}.NewLexer(input)
+}
+
+// Tokenize returns every token of input, lexed as standard SQL and
+// terminated by an EOF token
+func Tokenize(input string) ([]Token, error) {
+	return Options{}.Tokenize(input)
+}
+
+// Next returns the next token of the input
+func (lx *Lexer) Next() (Token, error) {
+	if err := lx.skipSpace(); err != nil {
+		return Token{}, err
+	}
+
+	pos := lx.pos()
+	if lx.offset >= len(lx.input) {
+		return Token{Kind: EOF, Pos: pos}, nil
+	}
+
+	r := lx.peek()
+	switch {
+	case isIdentStart(r):
+		word := lx.readWhile(isIdentPart)
+		if IsKeyword(word) {
+			return Token{Kind: Keyword, Text: strings.ToUpper(word), Pos: pos}, nil
+		}
+		return Token{Kind: Ident, Text: word, Pos: pos}, nil
+	case isDigit(r), r == '.' && isDigit(lx.peekAt(1)):
+		return Token{Kind: Number, Text: lx.readNumber(), Pos: pos}, nil
+	case r == '\'':
+		return lx.readString(pos)
+	case r == '`', r == '"':
+		return lx.readQuotedIdent(pos, r)
+	case r == '?':
+		lx.advance()
+		return Token{Kind: Placeholder, Text: "?", Pos: pos}, nil
+	case r == '$' && isDigit(lx.peekAt(1)):
+		lx.advance()
+		return Token{Kind: Placeholder, Text: "$" + lx.readWhile(isDigit), Pos: pos}, nil
+	case r == '@' && lx.peekAt(1) == '@' && isIdentStart(lx.peekAt(2)):
+		return Token{Kind: Variable, Text: lx.readVariable(), Pos: pos}, nil
+	}
+
+	for _, op := range []string{"<=", ">=", "<>", "!=", "||"} {
+		if strings.HasPrefix(lx.input[lx.offset:], op) {
+			lx.advance()
+			lx.advance()
+			return Token{Kind: Symbol, Text: op, Pos: pos}, nil
+		}
+	}
+	if strings.ContainsRune("=<>,.()*;+-/%", r) {
+		lx.advance()
+		return Token{Kind: Symbol, Text: string(r), Pos: pos}, nil
+	}
+
+	return Token{}, errorAt(pos, "unexpected character %q", r)
+}
+
+// readVariable reads a system variable, @@name or @@scope.name, and returns
+// it without its @@
+func (lx *Lexer) readVariable() string {
+	lx.advance()
+	lx.advance()
+	name := lx.readWhile(isIdentPart)
+	if lx.peek() == '.' && isIdentStart(lx.peekAt(1)) {
+		lx.advance()
+		name += "." + lx.readWhile(isIdentPart)
+	}
+	return name
+}
+
+// readNumber reads an integer or decimal number with an optional exponent,
+// such as 42, 9.99, .5 or 1e6
+func (lx *Lexer) readNumber() string {
+	start := lx.offset
+	lx.readWhile(isDigit)
+	if lx.peek() == '.' && isDigit(lx.peekAt(1)) {
+		lx.advance()
+		lx.readWhile(isDigit)
+	}
+	if r := lx.peek(); r == 'e' || r == 'E' {
+		next := lx.peekAt(1)
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(lx.peekAt(2)) {
+			lx.advance()
+			if !isDigit(next) {
+				lx.advance()
+			}
+			lx.readWhile(isDigit)
+		}
+	}
+	return lx.input[start:lx.offset]
+}
+
+// readString reads a single-quoted string literal. A quote is escaped by
+// doubling it ('O”Brien') or, with BackslashEscapes, with a backslash,
+// which also introduces \n, \t, \r, \0 and \\. \% and \_ keep their
+// backslash so they still escape LIKE wildcards.
+func (lx *Lexer) readString(pos Pos) (Token, error) {
+	lx.advance() // opening quote
+	var sb strings.Builder
+	for lx.offset < len(lx.input) {
+		r := lx.advance()
+		switch {
+		case r == '\'' && lx.peek() == '\'':
+			lx.advance()
+			sb.WriteRune('\'')
+		case r == '\'':
+			return Token{Kind: String, Text: sb.String(), Pos: pos}, nil
+		case r == '\\' && lx.opts.BackslashEscapes && lx.offset < len(lx.input):
+			switch e := lx.advance(); e {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case '0':
+				sb.WriteRune(0)
+			case '%', '_':
+				sb.WriteRune('\\')
+				sb.WriteRune(e)
+			default:
+				sb.WriteRune(e)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return Token{}, errorAt(pos, "unterminated string")
+}
+
+// readQuotedIdent reads an identifier quoted with backticks (MySQL) or
+// double quotes (ANSI SQL). The quote character is escaped by doubling it.
+// Quoted identifiers are never keywords and may hold any character.
+func (lx *Lexer) readQuotedIdent(pos Pos, quote rune) (Token, error) {
+	lx.advance() // opening quote
+	var sb strings.Builder
+	for lx.offset < len(lx.input) {
+		r := lx.advance()
+		if r == quote {
+			if lx.peek() != quote {
+				if sb.Len() == 0 {
+					return Token{}, errorAt(pos, "empty quoted identifier")
+				}
+				return Token{Kind: Ident, Text: sb.String(), Pos: pos, Quoted: true}, nil
+			}
+			lx.advance()
+		}
+		sb.WriteRune(r)
+	}
+	return Token{}, errorAt(pos, "unterminated quoted identifier")
+}
+
+// skipSpace skips white space and comments: "-- " and "#" up to the end of
+// the line, and "/* ... */". As in MySQL, "--" starts a comment only when
+// white space or the end of the input follows, so "age--1" still subtracts.
+func (lx *Lexer) skipSpace() error {
+	for lx.offset < len(lx.input) {
+		r := lx.peek()
+		switch {
+		case unicode.IsSpace(r):
+			lx.advance()
+		case r == '#', r == '-' && lx.peekAt(1) == '-' && (lx.peekAt(2) == 0 || unicode.IsSpace(lx.peekAt(2))):
+			lx.readWhile(func(r rune) bool { return r != '\n' })
+		case r == '/' && lx.peekAt(1) == '*':
+			pos := lx.pos()
+			end := strings.Index(lx.input[lx.offset+2:], "*/")
+			if end < 0 {
+				return errorAt(pos, "unterminated comment")
+			}
+			for stop := lx.offset + 2 + end + 2; lx.offset < stop; {
+				lx.advance()
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (lx *Lexer) readWhile(accept func(rune) bool) string {
+	start := lx.offset
+	for lx.offset < len(lx.input) && accept(lx.peek()) {
+		lx.advance()
+	}
+	return lx.input[start:lx.offset]
+}
+
+func (lx *Lexer) peek() rune {
+	r, _ := utf8.DecodeRuneInString(lx.input[lx.offset:])
+	return r
+}
+
+// peekAt returns the rune n runes after the current one, 0 past the end
+func (lx *Lexer) peekAt(n int) rune {
+	rest := lx.input[lx.offset:]
+	for ; n > 0 && rest != ""; n-- {
+		_, size := utf8.DecodeRuneInString(rest)
+		rest = rest[size:]
+	}
+	if rest == "" {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return r
+}
+
+func (lx *Lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(lx.input[lx.offset:])
+	lx.offset += size
+	if r == '\n' {
+		lx.line++
+		lx.column = 1
+	} else {
+		lx.column++
+	}
+	return r
+}
+
+func (lx *Lexer) pos() Pos {
+	return Pos{Offset: lx.offset, Line: lx.line, Column: lx.column}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || isDigit(r)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
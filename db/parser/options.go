@@ -0,0 +1,48 @@
+package parser
+
+// Options select the syntax that differs between SQL dialects. The zero
+// value follows standard SQL.
+type Options struct {
+	// BackslashEscapes makes a backslash in a string literal escape the
+	// character after it, as in MySQL. In standard SQL a backslash is an
+	// ordinary character and a quote is only escaped by doubling it.
+	BackslashEscapes bool
+	// PipesAsOr makes || a synonym of OR, as in MySQL without the
+	// PIPES_AS_CONCAT mode. In standard SQL || concatenates strings.
+	PipesAsOr bool
+}
+
+// MySQL are the options of MySQL and MariaDB
+var MySQL = Options{BackslashEscapes: true, PipesAsOr: true}
+
+// Parse parses a single SQL statement written with the syntax of o
+func (o Options) Parse(query string) (Statement, error) {
+	tokens, err := o.Tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	return newParser(tokens, o).parseAll()
+}
+
+// Tokenize returns every token of input, lexed with the syntax of o and
+// terminated by an EOF token
+func (o Options) Tokenize(input string) ([]Token, error) {
+	lx := o.NewLexer(input)
+	var tokens []Token
+	for {
+		tok, err := lx.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == EOF {
+			return tokens, nil
+		}
+	}
+}
+
+// NewLexer returns a lexer following the syntax of o, positioned at the
+// start of input
+func (o Options) NewLexer(input string) *Lexer {
+	return &Lexer{input: input, line: 1, column: 1, opts: o}
+}
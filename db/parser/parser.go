@@ -0,0 +1,1162 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parser is a recursive-descent parser over the tokens of a single query
+type Parser struct {
+	tokens []Token
+	pos    int
+	opts   Options
+	parens map[Statement]bool // queries written in parentheses
+	params int                // ? placeholders seen so far
+	dollar bool               // $n placeholders are used
+}
+
+// Parse parses a single SQL statement written in standard SQL
+func Parse(query string) (Statement, error) {
+	return Options{}.Parse(query)
+}
+
+func newParser(tokens []Token, opts Options) *Parser {
+	return &Parser{tokens: tokens, opts: opts, parens: make(map[Statement]bool)}
+}
+
+// parseAll parses a statement that must span every token, bar a final ";"
+func (p *Parser) parseAll() (Statement, error) {
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if tok := p.peek(); tok.Kind != EOF {
+		return nil, p.errorf(tok, "end of statement")
+	}
+	return stmt, nil
+}
+
+// ParseSelect parses query and checks that it is a SELECT statement
+func ParseSelect(query string) (*SelectStmt, error) {
+	stmt, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(*SelectStmt)
+	if !ok {
+		return nil, errorAt(Pos{Line: 1, Column: 1}, "unsupported query, expected a single SELECT")
+	}
+	return sel, nil
+}
+
+func (p *Parser) parseStatement() (Statement, error) {
+	tok := p.peek()
+	if tok.Kind == Keyword && tok.Text == "WITH" {
+		return p.parseWith()
+	}
+	if tok.Kind == Keyword && tok.Text == "SELECT" || tok.Kind == Symbol && tok.Text == "(" {
+		return p.parseQuery()
+	}
+	switch {
+	case p.acceptWord("EXPLAIN"):
+		return p.parseExplain()
+	case p.acceptWord("SHOW"):
+		return p.parseShow()
+	case p.acceptWord("SET"):
+		return p.parseSet()
+	case p.acceptWord("DESCRIBE"), p.acceptKeyword("DESC"):
+		table, err := p.parseTableName()
+		if err != nil {
+			return nil, err
+		}
+		return &ShowStmt{What: "COLUMNS", Table: table}, nil
+	}
+	return nil, p.errorf(tok, "SELECT")
+}
+
+// parseExplain parses the query after EXPLAIN. As in MySQL, "EXPLAIN
+// table" is a synonym of DESCRIBE.
+func (p *Parser) parseExplain() (Statement, error) {
+	// ANALYZE is also a valid table name
+	analyze := p.startsQueryAt(1) && p.acceptWord("ANALYZE")
+	if !analyze && p.peek().Kind == Ident {
+		table, err := p.parseTableName()
+		if err != nil {
+			return nil, err
+		}
+		return &ShowStmt{What: "COLUMNS", Table: table}, nil
+	}
+	if !p.startsQueryAt(0) {
+		return nil, p.errorf(p.peek(), "SELECT")
+	}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainStmt{Stmt: stmt, Analyze: analyze}, nil
+}
+
+// startsQueryAt checks whether the token n positions ahead of the current
+// one can start a query: SELECT, WITH or a parenthesis
+func (p *Parser) startsQueryAt(n int) bool {
+	if p.pos+n >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.pos+n]
+	return tok.Kind == Symbol && tok.Text == "(" || p.peekKeywordAt(n, "SELECT") || p.peekKeywordAt(n, "WITH")
+}
+
+// showAliases maps the words SHOW accepts to the statement they stand for
+var showAliases = map[string]string{
+	"TABLES":    "TABLES",
+	"DATABASES": "DATABASES",
+	"SCHEMAS":   "DATABASES",
+	"COLUMNS":   "COLUMNS",
+	"FIELDS":    "COLUMNS",
+	"INDEX":     "INDEX",
+	"INDEXES":   "INDEX",
+	"KEYS":      "INDEX",
+	"VARIABLES": "VARIABLES",
+	"WARNINGS":  "WARNINGS",
+}
+
+// parseShow parses the SHOW statements of MySQL clients and tools, after
+// SHOW. Their words aren't reserved, except FULL, so they are matched as
+// identifiers. Database names are accepted and ignored.
+func (p *Parser) parseShow() (Statement, error) {
+	stmt := &ShowStmt{Full: p.acceptKeyword("FULL")}
+	if !stmt.Full && !p.acceptWord("GLOBAL") {
+		p.acceptWord("SESSION")
+	}
+	tok := p.next()
+	what, ok := showAliases[strings.ToUpper(tok.Text)]
+	if tok.Kind != Ident || tok.Quoted || !ok {
+		return nil, p.errorf(tok, "TABLES", "DATABASES", "COLUMNS", "INDEX", "VARIABLES", "WARNINGS")
+	}
+	if stmt.Full && what != "TABLES" && what != "COLUMNS" {
+		return nil, errorAt(tok.Pos, "SHOW FULL %s is not supported", what)
+	}
+	stmt.What = what
+
+	switch what {
+	case "COLUMNS", "INDEX":
+		if !p.acceptKeyword("FROM") && !p.acceptKeyword("IN") {
+			return nil, p.errorf(p.peek(), "FROM")
+		}
+		table, err := p.parseTableName()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Table = table
+		fallthrough
+	case "TABLES":
+		if p.acceptKeyword("FROM") || p.acceptKeyword("IN") {
+			if _, err := p.expect(Ident); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if what != "INDEX" && what != "WARNINGS" && p.acceptKeyword("LIKE") {
+		if p.peek().Kind == Placeholder {
+			like, err := p.parseParam(p.next())
+			if err != nil {
+				return nil, err
+			}
+			stmt.Like = like
+		} else {
+			pattern, err := p.expect(String)
+			if err != nil {
+				return nil, err
+			}
+			stmt.Like = &Literal{Value: pattern.Text}
+		}
+	}
+	return stmt, nil
+}
+
+// parseTableName parses "table" or "database.table", returning the table
+func (p *Parser) parseTableName() (string, error) {
+	name, err := p.expect(Ident)
+	if err != nil {
+		return "", err
+	}
+	if p.acceptSymbol(".") {
+		if name, err = p.expect(Ident); err != nil {
+			return "", err
+		}
+	}
+	return name.Text, nil
+}
+
+// parseSet parses "NAMES charset [COLLATE collation]" or "[GLOBAL |
+// SESSION] variable = value, ..." after SET. A value can also be ON, as in
+// "SET autocommit = ON".
+func (p *Parser) parseSet() (Statement, error) {
+	if p.acceptWord("NAMES") {
+		charset := p.next()
+		if charset.Kind != Ident && charset.Kind != String {
+			return nil, p.errorf(charset, "character set")
+		}
+		stmt := &SetStmt{Names: charset.Text}
+		if p.acceptWord("COLLATE") {
+			collation := p.next()
+			if collation.Kind != Ident && collation.Kind != String {
+				return nil, p.errorf(collation, "collation")
+			}
+			stmt.Collate = collation.Text
+		}
+		return stmt, nil
+	}
+
+	stmt := &SetStmt{}
+	for {
+		v := &SetVar{}
+		for _, scope := range []string{"GLOBAL", "SESSION"} {
+			if p.acceptWord(scope) {
+				v.Scope = scope
+			}
+		}
+		name, err := p.expect(Ident)
+		if err != nil {
+			return nil, err
+		}
+		v.Name = name.Text
+		if !p.acceptSymbol("=") {
+			return nil, p.errorf(p.peek(), "=")
+		}
+		if p.acceptKeyword("ON") {
+			v.Value = &Literal{Value: "ON"}
+		} else if v.Value, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		stmt.Vars = append(stmt.Vars, v)
+		if !p.acceptSymbol(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// setOps lists the set operators by increasing precedence
+var setOps = [][]string{{"UNION", "EXCEPT"}, {"INTERSECT"}}
+
+// parseQuery parses a SELECT, or SELECTs combined with UNION, INTERSECT and
+// EXCEPT. The ORDER BY and LIMIT written after the last SELECT of a
+// combination apply to the whole of it, unless that SELECT is in parentheses.
+func (p *Parser) parseQuery() (Statement, error) {
+	stmt, err := p.parseSetOp(0)
+	if err != nil {
+		return nil, err
+	}
+	top, ok := stmt.(*SetOpStmt)
+	if !ok || p.parens[top] {
+		return stmt, nil
+	}
+	last := top.Right
+	for {
+		op, ok := last.(*SetOpStmt)
+		if !ok || p.parens[op] {
+			break
+		}
+		last = op.Right
+	}
+	if sel, ok := last.(*SelectStmt); ok && !p.parens[sel] {
+		top.OrderBy, top.Limit, top.Offset = sel.OrderBy, sel.Limit, sel.Offset
+		sel.OrderBy, sel.Limit, sel.Offset = nil, nil, nil
+	}
+	return top, nil
+}
+
+func (p *Parser) parseSetOp(level int) (Statement, error) {
+	if level == len(setOps) {
+		return p.parseQueryTerm()
+	}
+	left, err := p.parseSetOp(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op := ""
+		for _, word := range setOps[level] {
+			if p.acceptKeyword(word) {
+				op = word
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		if sel, ok := left.(*SelectStmt); ok && !p.parens[sel] && (len(sel.OrderBy) > 0 || sel.Limit != nil) {
+			return nil, errorAt(tok.Pos, "ORDER BY and LIMIT must follow the last query of a %s", op)
+		}
+		all := p.acceptKeyword("ALL")
+		if !all {
+			p.acceptKeyword("DISTINCT")
+		}
+		right, err := p.parseSetOp(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &SetOpStmt{Op: op, All: all, Left: left, Right: right}
+	}
+}
+
+// parseQueryTerm parses a SELECT or a query in parentheses
+func (p *Parser) parseQueryTerm() (Statement, error) {
+	if !p.acceptSymbol("(") {
+		return p.parseSelect()
+	}
+	stmt, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol(")") {
+		return nil, p.errorf(p.peek(), ")")
+	}
+	p.parens[stmt] = true
+	return stmt, nil
+}
+
+// parseWith parses "WITH [RECURSIVE] cte, ... query"
+func (p *Parser) parseWith() (Statement, error) {
+	if _, err := p.expectKeyword("WITH"); err != nil {
+		return nil, err
+	}
+	recursive := p.acceptKeyword("RECURSIVE")
+	var ctes []*CTE
+	for {
+		cte, err := p.parseCTE()
+		if err != nil {
+			return nil, err
+		}
+		ctes = append(ctes, cte)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	stmt, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	switch s := stmt.(type) {
+	case *SelectStmt:
+		s.With, s.Recursive = ctes, recursive
+	case *SetOpStmt:
+		s.With, s.Recursive = ctes, recursive
+	}
+	return stmt, nil
+}
+
+// parseCTE parses "name [(column, ...)] AS (SELECT ... [UNION [ALL] SELECT ...])"
+func (p *Parser) parseCTE() (*CTE, error) {
+	name, err := p.expect(Ident)
+	if err != nil {
+		return nil, err
+	}
+	cte := &CTE{Name: name.Text}
+	if p.acceptSymbol("(") {
+		for {
+			col, err := p.expect(Ident)
+			if err != nil {
+				return nil, err
+			}
+			cte.Columns = append(cte.Columns, col.Text)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if !p.acceptSymbol(")") {
+			return nil, p.errorf(p.peek(), ")")
+		}
+	}
+	if _, err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol("(") {
+		return nil, p.errorf(p.peek(), "(")
+	}
+	if cte.Select, err = p.parseSelect(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("UNION") {
+		cte.UnionAll = p.acceptKeyword("ALL")
+		if cte.Union, err = p.parseSelect(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.acceptSymbol(")") {
+		return nil, p.errorf(p.peek(), ")")
+	}
+	return cte, nil
+}
+
+func (p *Parser) parseSelect() (*SelectStmt, error) {
+	if _, err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &SelectStmt{Distinct: p.acceptKeyword("DISTINCT")}
+
+	for {
+		field, err := p.parseSelectField()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Fields = append(stmt.Fields, field)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("FROM") {
+		from, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.From = from
+
+		for p.peekJoin() {
+			join, err := p.parseJoin()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Joins = append(stmt.Joins, join)
+		}
+	}
+
+	if p.acceptKeyword("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if _, err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, expr)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("HAVING") {
+		having, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Having = having
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if _, err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			item, err := p.parseOrderItem()
+			if err != nil {
+				return nil, err
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if err := p.parseLimit(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseLimit parses "LIMIT count [OFFSET skip]" or MySQL's "LIMIT skip, count"
+func (p *Parser) parseLimit(stmt *SelectStmt) error {
+	first, err := p.parsePrimary()
+	if err != nil {
+		return err
+	}
+	stmt.Limit = first
+	if p.acceptSymbol(",") {
+		stmt.Offset = first
+		stmt.Limit, err = p.parsePrimary()
+		return err
+	}
+	if p.acceptKeyword("OFFSET") {
+		stmt.Offset, err = p.parsePrimary()
+	}
+	return err
+}
+
+// parseOrderItem parses "expr [ASC | DESC] [NULLS FIRST | NULLS LAST]".
+// NULLS, FIRST and LAST aren't reserved, so they are matched as identifiers.
+func (p *Parser) parseOrderItem() (*OrderItem, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	item := &OrderItem{Expr: expr}
+	if p.acceptKeyword("DESC") {
+		item.Desc = true
+	} else {
+		p.acceptKeyword("ASC")
+	}
+	if tok := p.peek(); tok.Kind == Ident && !tok.Quoted && strings.EqualFold(tok.Text, "NULLS") {
+		p.pos++
+		where := p.next()
+		switch {
+		case where.Kind == Ident && strings.EqualFold(where.Text, "FIRST"):
+			item.Nulls = NullsFirst
+		case where.Kind == Ident && strings.EqualFold(where.Text, "LAST"):
+			item.Nulls = NullsLast
+		default:
+			return nil, p.errorf(where, "FIRST", "LAST")
+		}
+	}
+	return item, nil
+}
+
+func (p *Parser) parseSelectField() (*SelectField, error) {
+	if p.acceptSymbol("*") {
+		return &SelectField{Expr: &StarExpr{}}, nil
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	return &SelectField{Expr: expr, Alias: alias}, nil
+}
+
+// parseAlias parses an optional "[AS] name"
+func (p *Parser) parseAlias() (string, error) {
+	if p.acceptKeyword("AS") {
+		tok, err := p.expect(Ident)
+		if err != nil {
+			return "", err
+		}
+		return tok.Text, nil
+	}
+	if tok := p.peek(); tok.Kind == Ident {
+		p.pos++
+		return tok.Text, nil
+	}
+	return "", nil
+}
+
+func (p *Parser) parseTableRef() (*TableRef, error) {
+	name, err := p.expect(Ident)
+	if err != nil {
+		return nil, err
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	return &TableRef{Name: name.Text, Alias: alias}, nil
+}
+
+// unsupportedJoins lists the words starting the joins the engine can't run
+var unsupportedJoins = []string{"NATURAL", "LEFT", "RIGHT", "FULL", "CROSS"}
+
+// peekJoin checks whether a join starts at the current token
+func (p *Parser) peekJoin() bool {
+	if p.peekKeyword("JOIN") || p.peekKeyword("INNER") {
+		return true
+	}
+	for _, word := range unsupportedJoins {
+		if p.peekKeyword(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJoin parses "[INNER] JOIN table ON expr". Outer, cross and natural
+// joins are rejected rather than run as inner joins.
+func (p *Parser) parseJoin() (*Join, error) {
+	start := p.peek()
+	kind := ""
+	for _, word := range unsupportedJoins {
+		if p.acceptKeyword(word) {
+			kind += word + " "
+			if (word == "LEFT" || word == "RIGHT" || word == "FULL") && p.acceptKeyword("OUTER") {
+				kind += "OUTER "
+			}
+		}
+	}
+	if kind == "" {
+		p.acceptKeyword("INNER")
+	}
+	if _, err := p.expectKeyword("JOIN"); err != nil {
+		return nil, err
+	}
+	if kind != "" {
+		return nil, errorAt(start.Pos, "%sJOIN is not supported", kind)
+	}
+	table, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	on, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &Join{Table: table, On: on}, nil
+}
+
+// parseExpr parses an expression, lowest precedence first. With the
+// PipesAsOr option, || is an OR rather than a sum operator:
+//
+//	expr       = and { OR and }
+//	and        = not { AND not }
+//	not        = NOT not | comparison
+//	comparison = sum [ ("=" | "<>" | "!=" | "<" | "<=" | ">" | ">=") sum
+//	                 | [NOT] IN "(" sum { "," sum } ")"
+//	                 | [NOT] BETWEEN sum AND sum
+//	                 | [NOT] (LIKE | ILIKE) sum [ESCAPE primary]
+//	                 | [NOT] (REGEXP | RLIKE) sum
+//	                 | IS [NOT] NULL ]
+//	sum        = product { ("+" | "-" | "||") product }
+//	product    = unary { ("*" | "/" | "%") unary }
+//	unary      = ("-" | "+") unary | primary
+//	literal    = ["-" | "+"] number | string | NULL | TRUE | FALSE | DATE string | TIMESTAMP string
+//	primary    = literal | "?" | "$" number | "@@" [scope "."] name | column | function "(" [ expr { "," expr } ] ")" | "(" expr ")" | case
+//	case       = CASE [expr] WHEN expr THEN expr { WHEN expr THEN expr } [ELSE expr] END
+func (p *Parser) parseExpr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") || p.opts.PipesAsOr && p.acceptSymbol("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *Parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	not := false
+	if p.peekKeyword("NOT") {
+		for _, word := range []string{"IN", "BETWEEN", "LIKE", "ILIKE", "REGEXP", "RLIKE"} {
+			if p.peekKeywordAt(1, word) {
+				not = true
+				p.pos++
+				break
+			}
+		}
+	}
+	switch {
+	case !not && p.acceptKeyword("IS"):
+		isNot := p.acceptKeyword("NOT")
+		if _, err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: left, Not: isNot}, nil
+	case p.acceptKeyword("IN"):
+		return p.parseIn(left, not)
+	case p.acceptKeyword("BETWEEN"):
+		return p.parseBetween(left, not)
+	case p.acceptKeyword("LIKE"):
+		return p.parseLike("LIKE", left, not)
+	case p.acceptKeyword("ILIKE"):
+		return p.parseLike("ILIKE", left, not)
+	case p.acceptKeyword("REGEXP"), p.acceptKeyword("RLIKE"):
+		return p.parseLike("REGEXP", left, not)
+	}
+
+	tok := p.peek()
+	if tok.Kind != Symbol {
+		return left, nil
+	}
+	switch tok.Text {
+	case "=", "<>", "!=", "<", "<=", ">", ">=":
+		p.pos++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Op: tok.Text, Left: left, Right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *Parser) parseIn(left Expr, not bool) (Expr, error) {
+	if !p.acceptSymbol("(") {
+		return nil, p.errorf(p.peek(), "(")
+	}
+	in := &InExpr{Expr: left, Not: not}
+	if p.peekKeyword("SELECT") {
+		sub, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		in.Subquery = sub
+		return in, nil
+	}
+	for {
+		item, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		in.List = append(in.List, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if !p.acceptSymbol(")") {
+		return nil, p.errorf(p.peek(), ")")
+	}
+	return in, nil
+}
+
+// parseSubquery parses the SELECT of a subquery and its closing parenthesis
+func (p *Parser) parseSubquery() (*SubqueryExpr, error) {
+	sel, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol(")") {
+		return nil, p.errorf(p.peek(), ")")
+	}
+	return &SubqueryExpr{Select: sel}, nil
+}
+
+func (p *Parser) parseBetween(left Expr, not bool) (Expr, error) {
+	// The bounds are arithmetic expressions so the AND separating them isn't
+	// taken for a conjunction
+	low, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	high, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &BetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+}
+
+func (p *Parser) parseLike(op string, left Expr, not bool) (Expr, error) {
+	pattern, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	like := &LikeExpr{Op: op, Expr: left, Pattern: pattern, Not: not}
+	if op != "REGEXP" && p.acceptKeyword("ESCAPE") {
+		if like.Escape, err = p.parsePrimary(); err != nil {
+			return nil, err
+		}
+	}
+	return like, nil
+}
+
+// parseAdditive parses +, - and the string concatenation ||, unless || is
+// OR in the syntax of the parser
+func (p *Parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	ops := []string{"+", "-", "||"}
+	if p.opts.PipesAsOr {
+		ops = ops[:2]
+	}
+	for {
+		op := p.acceptSymbols(ops...)
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// parseMultiplicative parses *, / and %
+func (p *Parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.acceptSymbols("*", "/", "%")
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// parseUnary parses a sign in front of an expression; a sign in front of a
+// number is part of the number literal
+func (p *Parser) parseUnary() (Expr, error) {
+	tok := p.peek()
+	if tok.Kind == Symbol && (tok.Text == "-" || tok.Text == "+") && p.tokens[p.pos+1].Kind != Number {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: tok.Text, Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parseCase parses "CASE [operand] WHEN ... THEN ... [ELSE ...] END", after CASE
+func (p *Parser) parseCase() (Expr, error) {
+	c := &CaseExpr{}
+	if !p.peekKeyword("WHEN") {
+		operand, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Operand = operand
+	}
+	for p.acceptKeyword("WHEN") {
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, &When{Cond: cond, Result: result})
+	}
+	if len(c.Whens) == 0 {
+		return nil, p.errorf(p.peek(), "WHEN")
+	}
+	if p.acceptKeyword("ELSE") {
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Else = result
+	}
+	if _, err := p.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *Parser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case Number:
+		return parseNumber(tok, false)
+	case String:
+		return &Literal{Value: tok.Text}, nil
+	case Keyword:
+		switch tok.Text {
+		case "NULL":
+			return &Literal{Value: nil}, nil
+		case "TRUE", "FALSE":
+			return &Literal{Value: tok.Text == "TRUE"}, nil
+		case "CASE":
+			return p.parseCase()
+		case "LEFT", "RIGHT":
+			// MySQL's LEFT(str, n) and RIGHT(str, n) are functions
+			if p.acceptSymbol("(") {
+				return p.parseCall(tok)
+			}
+		case "EXISTS":
+			if !p.acceptSymbol("(") {
+				return nil, p.errorf(p.peek(), "(")
+			}
+			sub, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &ExistsExpr{Subquery: sub}, nil
+		}
+	case Placeholder:
+		return p.parseParam(tok)
+	case Variable:
+		return parseVariable(tok)
+	case Symbol:
+		if (tok.Text == "-" || tok.Text == "+") && p.peek().Kind == Number {
+			return parseNumber(p.next(), tok.Text == "-")
+		}
+		if tok.Text == "(" && p.peekKeyword("SELECT") {
+			return p.parseSubquery()
+		}
+		if tok.Text == "(" {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.acceptSymbol(")") {
+				return nil, p.errorf(p.peek(), ")")
+			}
+			return expr, nil
+		}
+	case Ident:
+		// DATE and TIMESTAMP only introduce a literal when a string follows,
+		// so they remain usable as column names
+		word := strings.ToUpper(tok.Text)
+		if !tok.Quoted && (word == "DATE" || word == "TIMESTAMP") && p.peek().Kind == String {
+			str := p.next()
+			t, err := ParseTime(str.Text)
+			if err != nil {
+				return nil, errorAt(str.Pos, "invalid %s literal '%s'", word, str.Text)
+			}
+			return &Literal{Value: t}, nil
+		}
+		if p.acceptSymbol("(") {
+			return p.parseCall(tok)
+		}
+		if !p.acceptSymbol(".") {
+			return &ColumnRef{Name: tok.Text}, nil
+		}
+		if p.acceptSymbol("*") {
+			return &StarExpr{Table: tok.Text}, nil
+		}
+		name, err := p.expect(Ident)
+		if err != nil {
+			return nil, err
+		}
+		return &ColumnRef{Table: tok.Text, Name: name.Text}, nil
+	}
+	return nil, p.errorf(tok, "expression")
+}
+
+// parseNumber converts a number token to an int64, or a float64 when it has
+// a fraction or exponent or doesn't fit in an int64
+func parseNumber(tok Token, negative bool) (Expr, error) {
+	text := tok.Text
+	if negative {
+		text = "-" + text
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return &Literal{Value: n}, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, errorAt(tok.Pos, "invalid number %s", tok.Text)
+	}
+	return &Literal{Value: f}, nil
+}
+
+// parseVariable parses a system variable token. A LOCAL scope is the same
+// as SESSION.
+func parseVariable(tok Token) (Expr, error) {
+	scope, name, scoped := strings.Cut(tok.Text, ".")
+	if !scoped {
+		return &VarRef{Name: tok.Text}, nil
+	}
+	switch scope = strings.ToUpper(scope); scope {
+	case "LOCAL":
+		scope = "SESSION"
+	case "GLOBAL", "SESSION":
+	default:
+		return nil, errorAt(tok.Pos, "unknown scope %s of system variable %s", scope, name)
+	}
+	return &VarRef{Scope: scope, Name: name}, nil
+}
+
+// parseParam numbers a placeholder. A statement uses either ? or $n.
+func (p *Parser) parseParam(tok Token) (Expr, error) {
+	if tok.Text == "?" {
+		if p.dollar {
+			return nil, errorAt(tok.Pos, "cannot mix ? and $n placeholders")
+		}
+		p.params++
+		return &Param{Index: p.params}, nil
+	}
+	n, err := strconv.Atoi(tok.Text[1:])
+	if err != nil || n < 1 {
+		return nil, errorAt(tok.Pos, "invalid placeholder %s", tok.Text)
+	}
+	if p.params > 0 {
+		return nil, errorAt(tok.Pos, "cannot mix ? and $n placeholders")
+	}
+	p.dollar = true
+	return &Param{Index: n}, nil
+}
+
+// parseCall parses the arguments of a function call, after its "("
+func (p *Parser) parseCall(name Token) (Expr, error) {
+	call := &FuncCall{Name: strings.ToUpper(name.Text)}
+	if p.acceptSymbol(")") {
+		return call, nil
+	}
+	if p.acceptSymbol("*") {
+		// COUNT(*)
+		call.Args = []Expr{&StarExpr{}}
+		if !p.acceptSymbol(")") {
+			return nil, p.errorf(p.peek(), ")")
+		}
+		return call, nil
+	}
+	call.Distinct = p.acceptKeyword("DISTINCT")
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if !p.acceptSymbol(")") {
+		return nil, p.errorf(p.peek(), ")")
+	}
+	return call, nil
+}
+
+func (p *Parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *Parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != EOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *Parser) peekKeyword(word string) bool {
+	tok := p.peek()
+	return tok.Kind == Keyword && tok.Text == word
+}
+
+// peekKeywordAt checks the token n positions ahead of the current one
+func (p *Parser) peekKeywordAt(n int, word string) bool {
+	if p.pos+n >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.pos+n]
+	return tok.Kind == Keyword && tok.Text == word
+}
+
+// acceptWord consumes the current token if it is the unreserved word word,
+// written unquoted in any case
+func (p *Parser) acceptWord(word string) bool {
+	tok := p.peek()
+	if tok.Kind == Ident && !tok.Quoted && strings.EqualFold(tok.Text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *Parser) acceptKeyword(word string) bool {
+	if p.peekKeyword(word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// acceptSymbols consumes the current token if it is one of syms and returns
+// it, or returns ""
+func (p *Parser) acceptSymbols(syms ...string) string {
+	tok := p.peek()
+	if tok.Kind != Symbol {
+		return ""
+	}
+	for _, sym := range syms {
+		if tok.Text == sym {
+			p.pos++
+			return sym
+		}
+	}
+	return ""
+}
+
+func (p *Parser) acceptSymbol(sym string) bool {
+	tok := p.peek()
+	if tok.Kind == Symbol && tok.Text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expect(kind TokenKind) (Token, error) {
+	tok := p.peek()
+	if tok.Kind != kind {
+		return tok, p.errorf(tok, kind.String())
+	}
+	p.pos++
+	return tok, nil
+}
+
+func (p *Parser) expectKeyword(word string) (Token, error) {
+	tok := p.peek()
+	if tok.Kind != Keyword || tok.Text != word {
+		return tok, p.errorf(tok, word)
+	}
+	p.pos++
+	return tok, nil
+}
+
+// errorf reports that tok was found where one of expected was required
+func (p *Parser) errorf(tok Token, expected ...string) error {
+	return &ParseError{Pos: tok.Pos, Expected: expected, Found: tok.String()}
+}
@@ -0,0 +1,376 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"SELECT name, email FROM users WHERE country = 'India'",
+			"SELECT name, email FROM users WHERE (country = 'India')",
+		},
+		{
+			"select Name from Users u where u.age >= 30",
+			"SELECT Name FROM Users AS u WHERE (u.age >= 30)",
+		},
+		{
+			"SELECT * FROM users JOIN profiles p ON users.id = p.id",
+			"SELECT * FROM users JOIN profiles AS p ON (users.id = p.id)",
+		},
+		{
+			"SELECT * FROM users AS u INNER JOIN profiles AS p ON u.id = p.id",
+			"SELECT * FROM users AS u JOIN profiles AS p ON (u.id = p.id)",
+		},
+		{
+			"SELECT a FROM t WHERE price = 9.99 AND ok = true AND d < date '2024-05-01' AND n = 'O''Brien'",
+			"SELECT a FROM t WHERE ((((price = 9.99) AND (ok = TRUE)) AND (d < DATE '2024-05-01')) AND (n = 'O''Brien'))",
+		},
+		{
+			"SELECT -1.5, 1e6, .5, TIMESTAMP '2024-05-01 13:45:00', NULL FROM t",
+			"SELECT -1.5, 1e+06, 0.5, TIMESTAMP '2024-05-01 13:45:00', NULL FROM t",
+		},
+		{
+			"SELECT LEFT(name, 2), `left` FROM users",
+			"SELECT LEFT(name, 2), `left` FROM users",
+		},
+		{
+			"select 1 + 2, NOW()",
+			"SELECT (1 + 2), NOW()",
+		},
+		{
+			"SELECT @@version, @@LOCAL.sql_mode, @@Global.autocommit WHERE @@version <> ''",
+			"SELECT @@version, @@session.sql_mode, @@global.autocommit WHERE (@@version <> '')",
+		},
+		{
+			"show full tables like 'u%'",
+			"SHOW FULL TABLES LIKE 'u%'",
+		},
+		{
+			"SHOW FULL COLUMNS FROM users",
+			"SHOW FULL COLUMNS FROM users",
+		},
+		{
+			"SHOW TABLES LIKE ?",
+			"SHOW TABLES LIKE $1",
+		},
+		{
+			"SET autocommit = ?, SESSION sql_mode = ?",
+			"SET autocommit = $1, SESSION sql_mode = $2",
+		},
+		{
+			"SELECT a FROM t UNION ALL SELECT b FROM u ORDER BY a LIMIT 2",
+			"SELECT a FROM t UNION ALL SELECT b FROM u ORDER BY a LIMIT 2",
+		},
+		{
+			"SELECT a FROM t UNION SELECT a FROM u INTERSECT SELECT a FROM v",
+			"SELECT a FROM t UNION (SELECT a FROM u INTERSECT SELECT a FROM v)",
+		},
+		{
+			"(SELECT a FROM t EXCEPT SELECT a FROM u) UNION SELECT a FROM v",
+			"(SELECT a FROM t EXCEPT SELECT a FROM u) UNION SELECT a FROM v",
+		},
+		{
+			"SELECT price * (qty + 1) - 2 % 3 AS total, a || b FROM t",
+			"SELECT ((price * (qty + 1)) - (2 % 3)) AS total, (a || b) FROM t",
+		},
+		{
+			"SELECT CASE WHEN a > 1 THEN 'x' ELSE 'y' END, case a when 1 then 2 end FROM t",
+			"SELECT CASE WHEN (a > 1) THEN 'x' ELSE 'y' END, CASE a WHEN 1 THEN 2 END FROM t",
+		},
+		{
+			"SELECT a FROM t WHERE a = ? AND b IN (?, ?) LIMIT ?",
+			"SELECT a FROM t WHERE ((a = $1) AND (b IN ($2, $3))) LIMIT $4",
+		},
+		{
+			"SELECT a FROM t WHERE a = $2 OR b = $1",
+			"SELECT a FROM t WHERE ((a = $2) OR (b = $1))",
+		},
+	}
+	for _, tt := range tests {
+		checkRoundTrip(t, tt.query, tt.want)
+	}
+}
+
+// checkRoundTrip checks that query parses to a statement printed as want,
+// which parses back to the same statement
+func checkRoundTrip(t *testing.T, query, want string) {
+	t.Helper()
+	stmt, err := Parse(query)
+	if err != nil {
+		t.Errorf("Parse(%q): %v", query, err)
+		return
+	}
+	if got := stmt.String(); got != want {
+		t.Errorf("Parse(%q) = %s, want %s", query, got, want)
+		return
+	}
+	again, err := Parse(want)
+	if err != nil {
+		t.Errorf("Parse(%q): %v", want, err)
+		return
+	}
+	if got := again.String(); got != want {
+		t.Errorf("Parse(%q) = %s, want it unchanged", want, got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query        string
+		line, column int
+		msg          string
+	}{
+		{"SELECT a FROM t WHERE", 1, 22, "expected expression"},
+		{"SELECT a FROM t WHERE a = 'x", 1, 27, "unterminated string"},
+		{"SELECT a\nFROM", 2, 5, "expected identifier"},
+		{"FROM t", 1, 1, "expected SELECT"},
+		{"SELECT a FROM t WHERE a = = 1", 1, 27, "expected expression"},
+		{"SELECT a FROM t u v", 1, 19, "expected end of statement"},
+		{"SELECT a FROM t JOIN u", 1, 23, "expected ON"},
+		{"SELECT a FROM t WHERE a ~ 1", 1, 25, "unexpected character"},
+		{"SELECT * FROM users LEFT JOIN profiles ON users.id = profiles.id", 1, 21, "LEFT JOIN is not supported"},
+		{"SELECT * FROM users u LEFT OUTER JOIN profiles p ON u.id = p.id", 1, 23, "LEFT OUTER JOIN is not supported"},
+		{"SELECT * FROM users RIGHT JOIN profiles ON users.id = profiles.id", 1, 21, "RIGHT JOIN is not supported"},
+		{"SELECT * FROM users FULL OUTER JOIN profiles ON users.id = profiles.id", 1, 21, "FULL OUTER JOIN is not supported"},
+		{"SELECT * FROM users CROSS JOIN profiles", 1, 21, "CROSS JOIN is not supported"},
+		{"SELECT * FROM users NATURAL JOIN profiles", 1, 21, "NATURAL JOIN is not supported"},
+		{"SELECT * FROM users AS left JOIN profiles ON users.id = left.id", 1, 24, "expected identifier"},
+		{"SELECT * FROM users LEFT profiles", 1, 26, "expected JOIN"},
+		{"SELECT @@foo.version", 1, 8, "unknown scope FOO of system variable version"},
+		{"SELECT @version", 1, 8, "unexpected character '@'"},
+		{"SELECT 1 WHERE", 1, 15, "expected expression"},
+	}
+	for _, tt := range tests {
+		checkParseError(t, tt.query, tt.line, tt.column, tt.msg)
+	}
+}
+
+// checkParseError checks that query fails to parse with a 1064 ParseError
+// at line and column whose message holds msg
+func checkParseError(t *testing.T, query string, line, column int, msg string) {
+	t.Helper()
+	_, err := Parse(query)
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Errorf("Parse(%q) error = %v, want a ParseError", query, err)
+		return
+	}
+	if perr.Line() != line || perr.Column() != column || perr.Code() != 1064 {
+		t.Errorf("Parse(%q) error at %d:%d code %d, want %d:%d code 1064", query, perr.Line(), perr.Column(), perr.Code(), line, column)
+	}
+	if !strings.Contains(perr.Error(), msg) {
+		t.Errorf("Parse(%q) error = %q, want it to mention %q", query, perr.Error(), msg)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize("select name, 42 from users\nwhere age>=1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{
+		{Kind: Keyword, Text: "SELECT", Pos: Pos{0, 1, 1}},
+		{Kind: Ident, Text: "name", Pos: Pos{7, 1, 8}},
+		{Kind: Symbol, Text: ",", Pos: Pos{11, 1, 12}},
+		{Kind: Number, Text: "42", Pos: Pos{13, 1, 14}},
+		{Kind: Keyword, Text: "FROM", Pos: Pos{16, 1, 17}},
+		{Kind: Ident, Text: "users", Pos: Pos{21, 1, 22}},
+		{Kind: Keyword, Text: "WHERE", Pos: Pos{27, 2, 1}},
+		{Kind: Ident, Text: "age", Pos: Pos{33, 2, 7}},
+		{Kind: Symbol, Text: ">=", Pos: Pos{36, 2, 10}},
+		{Kind: Number, Text: "1.5", Pos: Pos{38, 2, 12}},
+		{Kind: EOF, Pos: Pos{41, 2, 15}},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("Tokenize returned %d tokens, want %d: %v", len(tokens), len(want), tokens)
+	}
+	for i := range want {
+		if tokens[i] != want[i] {
+			t.Errorf("token %d = %+v, want %+v", i, tokens[i], want[i])
+		}
+	}
+}
+
+func TestBackslashEscapes(t *testing.T) {
+	tests := []struct {
+		literal         string
+		standard, mysql string
+	}{
+		{`'C:\path'`, `C:\path`, "C:path"},
+		{`'it\'s'`, "", "it's"},
+		{`'a\nb'`, `a\nb`, "a\nb"},
+		{`'a\\b'`, `a\\b`, `a\b`},
+		{`'100\%'`, `100\%`, `100\%`},
+		{`'it''s'`, "it's", "it's"},
+	}
+	for _, tt := range tests {
+		for _, dialect := range []struct {
+			opts Options
+			want string
+		}{{Options{}, tt.standard}, {MySQL, tt.mysql}} {
+			tokens, err := dialect.opts.Tokenize(tt.literal)
+			if dialect.want == "" {
+				// the backslash doesn't escape the quote: the string is
+				// closed early and the rest is another token
+				if err == nil && len(tokens) == 2 {
+					t.Errorf("Tokenize(%q) with %+v = %v, want more tokens", tt.literal, dialect.opts, tokens)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Tokenize(%q) with %+v: %v", tt.literal, dialect.opts, err)
+				continue
+			}
+			if tokens[0].Kind != String || tokens[0].Text != dialect.want {
+				t.Errorf("Tokenize(%q) with %+v = %v, want '%s'", tt.literal, dialect.opts, tokens[0], dialect.want)
+			}
+		}
+	}
+}
+
+func TestPipesAsOr(t *testing.T) {
+	tests := []struct {
+		query           string
+		standard, mysql string
+	}{
+		{
+			"SELECT a || b FROM t",
+			"SELECT (a || b) FROM t",
+			"SELECT (a OR b) FROM t",
+		},
+		{
+			"SELECT a FROM t WHERE a = 1 || b = 2 AND c = 3",
+			"", // a = (1 || b) = 2 doesn't parse
+			"SELECT a FROM t WHERE ((a = 1) OR ((b = 2) AND (c = 3)))",
+		},
+		{
+			"SELECT a FROM t WHERE a || 'x' = 'yx'",
+			"SELECT a FROM t WHERE ((a || 'x') = 'yx')",
+			"SELECT a FROM t WHERE (a OR ('x' = 'yx'))",
+		},
+	}
+	for _, tt := range tests {
+		for _, dialect := range []struct {
+			opts Options
+			want string
+		}{{Options{}, tt.standard}, {MySQL, tt.mysql}} {
+			stmt, err := dialect.opts.Parse(tt.query)
+			if dialect.want == "" {
+				if err == nil {
+					t.Errorf("Parse(%q) with %+v = %s, want an error", tt.query, dialect.opts, stmt)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Parse(%q) with %+v: %v", tt.query, dialect.opts, err)
+			} else if got := stmt.String(); got != dialect.want {
+				t.Errorf("Parse(%q) with %+v = %s, want %s", tt.query, dialect.opts, got, dialect.want)
+			}
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"sElEcT name FrOm users wHeRe age >= 30", "SELECT name FROM users WHERE (age >= 30)"},
+		{"SELECT `order`, \"first name\" FROM t", "SELECT `order`, `first name` FROM t"},
+		{"SELECT `a``b`, \"c\"\"d\" FROM `my table`", "SELECT `a``b`, `c\"d` FROM `my table`"},
+		{"SELECT `select` AS `from` FROM t WHERE `where` = 1", "SELECT `select` AS `from` FROM t WHERE (`where` = 1)"},
+		{"SELECT t.`first name` FROM t", "SELECT t.`first name` FROM t"},
+		{"SELECT Name FROM t", "SELECT Name FROM t"},
+	}
+	for _, tt := range tests {
+		checkRoundTrip(t, tt.query, tt.want)
+	}
+
+	checkParseError(t, "SELECT `` FROM t", 1, 8, "empty quoted identifier")
+	checkParseError(t, "SELECT `a FROM t", 1, 8, "unterminated quoted identifier")
+	checkParseError(t, "SELECT order FROM t", 1, 8, "expected expression")
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := map[string]string{
+		"name":       "name",
+		"order":      "`order`",
+		"first name": "`first name`",
+		"a`b":        "`a``b`",
+		"1st":        "`1st`",
+	}
+	for name, want := range tests {
+		if got := QuoteIdent(name); got != want {
+			t.Errorf("QuoteIdent(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT a -- the a column\nFROM t", "SELECT a FROM t"},
+		{"SELECT a # MySQL style\nFROM t --", "SELECT a FROM t"},
+		{"/* leading */ SELECT /* inside; with a ; */ a FROM t /* trailing */", "SELECT a FROM t"},
+		{"SELECT a FROM t WHERE b = 5 --1", "SELECT a FROM t WHERE (b = (5 - -1))"},
+		{"SELECT '-- not a comment', '/* nor this */' FROM t", "SELECT '-- not a comment', '/* nor this */' FROM t"},
+	}
+	for _, tt := range tests {
+		checkRoundTrip(t, tt.query, tt.want)
+	}
+	checkParseError(t, "SELECT a /* open\nFROM t", 1, 10, "unterminated comment")
+}
+
+func TestParseScript(t *testing.T) {
+	script := `-- report queries
+SELECT a FROM t;;
+/* second; still a comment */
+SELECT 'x;y' FROM u;
+SELECT FROM v;
+SELECT c FROM w`
+	stmts := ParseScript(script)
+	want := []struct {
+		text      string
+		line, col int
+		err       string
+	}{
+		{"SELECT a FROM t", 2, 1, ""},
+		{"SELECT 'x;y' FROM u", 4, 1, ""},
+		{"SELECT FROM v", 5, 1, "expected expression at line 5, column 8"},
+		{"SELECT c FROM w", 6, 1, ""},
+	}
+	if len(stmts) != len(want) {
+		t.Fatalf("ParseScript returned %d statements, want %d", len(stmts), len(want))
+	}
+	for i, w := range want {
+		s := stmts[i]
+		if s.Text != w.text || s.Pos.Line != w.line || s.Pos.Column != w.col {
+			t.Errorf("statement %d = %q at %s, want %q at %d:%d", i+1, s.Text, s.Pos, w.text, w.line, w.col)
+		}
+		switch {
+		case w.err == "" && s.Err != nil:
+			t.Errorf("statement %d: %v", i+1, s.Err)
+		case w.err == "" && s.Stmt == nil:
+			t.Errorf("statement %d wasn't parsed", i+1)
+		case w.err != "" && (s.Err == nil || !strings.Contains(s.Err.Error(), w.err)):
+			t.Errorf("statement %d error = %v, want %q", i+1, s.Err, w.err)
+		}
+	}
+
+	// an unterminated string ends the script
+	stmts = ParseScript("SELECT a FROM t; SELECT 'open FROM u; SELECT b FROM v")
+	if len(stmts) != 2 || stmts[1].Err == nil || stmts[1].Text != "SELECT 'open FROM u; SELECT b FROM v" {
+		t.Errorf("ParseScript with an unterminated string = %+v", stmts)
+	}
+	if stmts := ParseScript("  -- nothing\n;; /* here */ "); len(stmts) != 0 {
+		t.Errorf("ParseScript of comments = %+v, want no statement", stmts)
+	}
+}
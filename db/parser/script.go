@@ -0,0 +1,59 @@
+package parser
+
+import "strings"
+
+// ScriptStatement is one statement of a script
+type ScriptStatement struct {
+	Text string    // the text of the statement, without its ";"
+	Pos  Pos       // where the statement starts in the script
+	Stmt Statement // the parsed statement, nil when Err is set
+	Err  error
+}
+
+// ParseScript splits script into statements separated by ";" and parses
+// each of them. Comments and empty statements are skipped. A statement that
+// doesn't parse gets an Err and the following ones are still parsed, except
+// after an error splitting the script into tokens, such as an unterminated
+// string: the rest of the script is then the failing statement. Error
+// positions are positions in the script. The script is written in standard
+// SQL.
+func ParseScript(script string) []*ScriptStatement {
+	return Options{}.ParseScript(script)
+}
+
+// ParseScript splits and parses a script written with the syntax of o, as
+// the ParseScript function does
+func (o Options) ParseScript(script string) []*ScriptStatement {
+	lx := o.NewLexer(script)
+	var stmts []*ScriptStatement
+	var tokens []Token
+	end := 0 // where the last token of the statement ends
+	for {
+		tok, err := lx.Next()
+		if err != nil {
+			s := &ScriptStatement{Err: err}
+			if len(tokens) > 0 {
+				s.Pos = tokens[0].Pos
+			} else if perr, ok := err.(*ParseError); ok {
+				s.Pos = perr.Pos
+			}
+			s.Text = strings.TrimSpace(script[s.Pos.Offset:])
+			return append(stmts, s)
+		}
+		if tok.Kind != EOF && !(tok.Kind == Symbol && tok.Text == ";") {
+			tokens = append(tokens, tok)
+			end = lx.offset
+			continue
+		}
+
+		if len(tokens) > 0 {
+			s := &ScriptStatement{Text: script[tokens[0].Pos.Offset:end], Pos: tokens[0].Pos}
+			s.Stmt, s.Err = newParser(append(tokens, Token{Kind: EOF, Pos: tok.Pos}), o).parseAll()
+			stmts = append(stmts, s)
+			tokens = nil
+		}
+		if tok.Kind == EOF {
+			return stmts
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Layouts of DATE and TIMESTAMP values
+const (
+	DateLayout      = "2006-01-02"
+	TimestampLayout = "2006-01-02 15:04:05.999999999"
+)
+
+var timeLayouts = []string{
+	TimestampLayout,
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+	DateLayout,
+}
+
+// ParseTime parses a date ("2024-05-01") or a timestamp ("2024-05-01 13:45:00",
+// optionally with fractional seconds or in RFC 3339 form), in UTC unless a
+// zone is given
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date or timestamp %q", s)
+}
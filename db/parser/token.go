@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind identifies the lexical class of a token
+type TokenKind int
+
+const (
+	EOF TokenKind = iota
+	Ident
+	Keyword
+	String
+	Number
+	Symbol
+	Placeholder // a ? or $n parameter
+	Variable    // a @@ system variable, its text without the @@
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case EOF:
+		return "end of input"
+	case Ident:
+		return "identifier"
+	case Keyword:
+		return "keyword"
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	case Symbol:
+		return "symbol"
+	case Placeholder:
+		return "placeholder"
+	case Variable:
+		return "system variable"
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Pos is a location in the query text, lines and columns start at 1
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// Token is a single lexical unit of a query. Keywords are stored upper-cased,
+// string literals and quoted identifiers without their quotes.
+type Token struct {
+	Kind   TokenKind
+	Text   string
+	Pos    Pos
+	Quoted bool // a `backtick` or "double-quoted" identifier
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case EOF:
+		return t.Kind.String()
+	case String:
+		return fmt.Sprintf("'%s'", t.Text)
+	case Ident:
+		return QuoteIdent(t.Text)
+	case Variable:
+		return "@@" + t.Text
+	}
+	return fmt.Sprintf("%q", t.Text)
+}
+
+// keywords lists the reserved words of the dialect
+var keywords = map[string]bool{
+	"SELECT":    true,
+	"FROM":      true,
+	"WHERE":     true,
+	"AND":       true,
+	"OR":        true,
+	"NOT":       true,
+	"IN":        true,
+	"BETWEEN":   true,
+	"LIKE":      true,
+	"ILIKE":     true,
+	"REGEXP":    true,
+	"RLIKE":     true,
+	"ESCAPE":    true,
+	"IS":        true,
+	"NULL":      true,
+	"TRUE":      true,
+	"FALSE":     true,
+	"AS":        true,
+	"JOIN":      true,
+	"INNER":     true,
+	"LEFT":      true,
+	"RIGHT":     true,
+	"FULL":      true,
+	"OUTER":     true,
+	"CROSS":     true,
+	"NATURAL":   true,
+	"ON":        true,
+	"ORDER":     true,
+	"BY":        true,
+	"ASC":       true,
+	"DESC":      true,
+	"LIMIT":     true,
+	"OFFSET":    true,
+	"GROUP":     true,
+	"DISTINCT":  true,
+	"HAVING":    true,
+	"EXISTS":    true,
+	"WITH":      true,
+	"RECURSIVE": true,
+	"UNION":     true,
+	"ALL":       true,
+	"INTERSECT": true,
+	"EXCEPT":    true,
+	"CASE":      true,
+	"WHEN":      true,
+	"THEN":      true,
+	"ELSE":      true,
+	"END":       true,
+}
+
+// QuoteIdent returns name as it must be written in a query: in backticks
+// when it is a keyword or isn't a plain identifier
+func QuoteIdent(name string) string {
+	plain := name != "" && !IsKeyword(name)
+	for i, r := range name {
+		if !isIdentPart(r) || i == 0 && !isIdentStart(r) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// IsKeyword reports whether word is a reserved keyword, ignoring case
+func IsKeyword(word string) bool {
+	return keywords[strings.ToUpper(word)]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"db-parse/engine"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ctx = context.Background()
+
+	// Redis client for KeyDB
+	rdb = redis.NewClient(&redis.Options{
+		Addr: "localhost:6379", // KeyDB server address
+	})
+)
+
+// Runs the SQL script files given as arguments, or standard input, against KeyDB:
+//
+//	go run ./script -continue -tables tables.json queries.sql
+func main() {
+	continueOnError := flag.Bool("continue", false, "run the remaining statements after a failing one")
+	mysql := flag.Bool("mysql", false, "follow the MySQL dialect")
+	tables := flag.String("tables", "", "JSON file mapping table names to key patterns")
+	flag.Parse()
+
+	eng := engine.New(rdb)
+	if err := eng.AddTable(&engine.Table{Name: "users", Pattern: "user:{id}"}); err != nil {
+		log.Fatalf("Error adding table: %v\n", err)
+	}
+	if *tables != "" {
+		if err := eng.LoadTables(*tables); err != nil {
+			log.Fatalf("Error loading tables: %v\n", err)
+		}
+	}
+	if *mysql {
+		eng.Dialect = engine.MySQL
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	failed := false
+	for _, file := range files {
+		script, err := readScript(file)
+		if err != nil {
+			log.Fatalf("Error reading script: %v\n", err)
+		}
+		results, err := eng.ExecScript(ctx, script, *continueOnError)
+		for _, r := range results {
+			fmt.Printf("-- %s (%s)\n", r.Query, r.Pos)
+			if r.Err != nil {
+				code, state := engine.ErrorCode(r.Err)
+				fmt.Printf("ERROR %d (%s): %v\n\n", code, state, r.Err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s\n\n", r.Result)
+		}
+		if err != nil {
+			log.Fatalf("Script %s stopped: %v\n", file, err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// readScript reads a script file, "-" being standard input
+func readScript(file string) (string, error) {
+	if file == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(file)
+	return string(data), err
+}